@@ -0,0 +1,136 @@
+package virt
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// AtomicOS is like OS, but WriteFile replaces files atomically. The data is
+// written to a temporary file in the same directory, synced to disk, then
+// renamed over the original. Readers see either the old file or the new one,
+// never a partially written file, even if the process crashes.
+//
+// Since files are replaced rather than truncated, they always end up with the
+// given mode, and writing to a symlink replaces the symlink rather than its
+// target. Files written through OpenFile aren't atomic.
+//
+// Use SyncFS or WriteFS to sync or write to an AtomicOS directory.
+type AtomicOS string
+
+var _ FS = (AtomicOS)("")
+
+func (dir AtomicOS) Open(name string) (fs.File, error) {
+	return OS(dir).Open(name)
+}
+
+func (dir AtomicOS) Stat(name string) (fs.FileInfo, error) {
+	return OS(dir).Stat(name)
+}
+
+func (dir AtomicOS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return OS(dir).ReadDir(name)
+}
+
+func (dir AtomicOS) Lstat(name string) (fs.FileInfo, error) {
+	return OS(dir).Lstat(name)
+}
+
+func (dir AtomicOS) Readlink(name string) (string, error) {
+	return OS(dir).Readlink(name)
+}
+
+func (dir AtomicOS) OpenFile(name string, flag int, perm fs.FileMode) (RWFile, error) {
+	return OS(dir).OpenFile(name, flag, perm)
+}
+
+func (dir AtomicOS) MkdirAll(path string, perm fs.FileMode) error {
+	return OS(dir).MkdirAll(path, perm)
+}
+
+func (dir AtomicOS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "WriteFile", Path: name, Err: fs.ErrInvalid}
+	}
+	if perm&fs.ModeSymlink != 0 {
+		return OS(dir).WriteFile(name, data, perm)
+	}
+	return writeFileAtomic(string(dir), name, data, perm)
+}
+
+func (dir AtomicOS) RemoveAll(path string) error {
+	return OS(dir).RemoveAll(path)
+}
+
+// writeFileAtomic writes the data to a temporary file, then renames it to name
+// within dir, syncing both the file and its directory. Errors report the name
+// rather than the paths on disk.
+func writeFileAtomic(dir, name string, data []byte, perm fs.FileMode) (err error) {
+	fpath := filepath.Join(dir, filepath.FromSlash(name))
+	// Renaming over a directory fails with a platform-specific error
+	if info, err := os.Lstat(fpath); err == nil && info.IsDir() {
+		return &fs.PathError{Op: "WriteFile", Path: name, Err: errIsDirectory}
+	}
+	parent := filepath.Dir(fpath)
+	tmp, err := os.CreateTemp(parent, "."+filepath.Base(fpath)+".*.tmp")
+	if err != nil {
+		return atomicError("WriteFile", name, err)
+	}
+	// Cleanup the temporary file if anything fails before the rename
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		return atomicError("WriteFile", name, err)
+	}
+	// Temporary files are created with 0600, so set the mode explicitly
+	if err := tmp.Chmod(perm.Perm()); err != nil {
+		return atomicError("WriteFile", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return atomicError("WriteFile", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return atomicError("WriteFile", name, err)
+	}
+	if err := os.Rename(tmp.Name(), fpath); err != nil {
+		return atomicError("rename", name, err)
+	}
+	if err := syncDir(parent); err != nil {
+		return atomicError("WriteFile", name, err)
+	}
+	return nil
+}
+
+// atomicError wraps the error in a *fs.PathError with the name, replacing the
+// paths on disk that the OS reports
+func atomicError(op, name string, err error) error {
+	switch e := err.(type) {
+	case *fs.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// syncDir syncs the directory, so renames within it are durable
+func syncDir(dir string) error {
+	// Directories can't be synced on Windows
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
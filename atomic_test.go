@@ -0,0 +1,93 @@
+package virt_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestAtomicWriteFile(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	fsys := virt.AtomicOS(dir)
+	is.NoErr(fsys.MkdirAll("a", 0755))
+	is.NoErr(fsys.WriteFile("a/b.txt", []byte("b"), 0644))
+	data, err := os.ReadFile(filepath.Join(dir, "a/b.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "b")
+	info, err := os.Stat(filepath.Join(dir, "a/b.txt"))
+	is.NoErr(err)
+	is.Equal(info.Mode(), fs.FileMode(0644))
+	// No temporary files are left behind
+	des, err := os.ReadDir(filepath.Join(dir, "a"))
+	is.NoErr(err)
+	is.Equal(len(des), 1)
+	is.Equal(des[0].Name(), "b.txt")
+}
+
+func TestAtomicWriteFileReplace(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	fsys := virt.AtomicOS(dir)
+	is.NoErr(fsys.WriteFile("a.txt", []byte("before"), 0644))
+	// Open readers keep seeing the old file
+	file, err := fsys.Open("a.txt")
+	is.NoErr(err)
+	defer file.Close()
+	is.NoErr(fsys.WriteFile("a.txt", []byte("after!"), 0600))
+	data, err := io.ReadAll(file)
+	is.NoErr(err)
+	is.Equal(string(data), "before")
+	data, err = fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "after!")
+	// Unlike OS, the mode is replaced too
+	info, err := fsys.Stat("a.txt")
+	is.NoErr(err)
+	is.Equal(info.Mode(), fs.FileMode(0600))
+}
+
+func TestAtomicWriteFileError(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	fsys := virt.AtomicOS(dir)
+	is.NoErr(fsys.MkdirAll("a", 0755))
+	// Errors report the name, not the path on disk
+	err := fsys.WriteFile("a", []byte("a"), 0644)
+	var pathErr *fs.PathError
+	is.True(errors.As(err, &pathErr))
+	is.Equal(pathErr.Path, "a")
+	err = fsys.WriteFile("missing/a.txt", []byte("a"), 0644)
+	is.True(errors.Is(err, fs.ErrNotExist))
+	is.True(errors.As(err, &pathErr))
+	is.Equal(pathErr.Path, "missing/a.txt")
+	err = fsys.WriteFile("../a.txt", []byte("a"), 0644)
+	is.True(err != nil)
+	// The temporary file is removed
+	des, err := os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(des), 1)
+}
+
+func TestAtomicSync(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	from := virt.Map{
+		"a.txt":   "a",
+		"b/b.txt": "b",
+	}
+	is.NoErr(virt.SyncFS(from, virt.AtomicOS(dir)))
+	data, err := os.ReadFile(filepath.Join(dir, "b/b.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "b")
+	is.NoErr(virt.WriteFS(virt.Map{"a.txt": "aa"}, virt.AtomicOS(dir)))
+	data, err = os.ReadFile(filepath.Join(dir, "a.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "aa")
+}
@@ -0,0 +1,378 @@
+package virt
+
+import (
+	"container/list"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheOption configures Cache
+type CacheOption func(*CacheFS)
+
+// CacheTTL trusts cached entries for the duration before checking them against
+// the underlying filesystem again. By default, entries are checked on every
+// access by comparing their size, mode and modification time, which avoids
+// reading the data but still stats the file.
+func CacheTTL(ttl time.Duration) CacheOption {
+	return func(c *CacheFS) {
+		c.ttl = ttl
+	}
+}
+
+// CacheSize sets the approximate number of bytes the cache may hold before the
+// least recently used entries are evicted. Defaults to 64MiB. Files larger than
+// the cache are read through without being cached.
+func CacheSize(bytes int64) CacheOption {
+	return func(c *CacheFS) {
+		c.budget = bytes
+	}
+}
+
+// CacheStats are counters for a cache
+type CacheStats struct {
+	Hits      int
+	Misses    int
+	Evictions int
+	Bytes     int64
+}
+
+// Cache file data and directory listings from fsys in memory. Cached entries
+// are revalidated against fsys like Sync does, by comparing their size, mode
+// and modification time. Writes through the cache invalidate the entries they
+// change. If fsys doesn't implement FS, writes fail with fs.ErrPermission.
+//
+// Lstat and Readlink aren't cached. The cache is safe for concurrent use.
+func Cache(fsys fs.FS, options ...CacheOption) *CacheFS {
+	c := &CacheFS{
+		fs:      fsys,
+		budget:  64 << 20,
+		tree:    Tree{},
+		entries: map[string]*cacheEntry{},
+		lru:     list.New(),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// CacheFS is a read-through cache for a filesystem
+type CacheFS struct {
+	fs     fs.FS
+	ttl    time.Duration
+	budget int64
+
+	mu      sync.Mutex
+	tree    Tree // Loaded file data and directory entries
+	entries map[string]*cacheEntry
+	lru     *list.List // Most recently used paths are in front
+	stats   CacheStats
+}
+
+var _ FS = (*CacheFS)(nil)
+var _ fs.ReadDirFS = (*CacheFS)(nil)
+var _ fs.ReadFileFS = (*CacheFS)(nil)
+
+// cacheEntry is the state of a cached path. The data or directory entries are
+// stored in the tree once they're loaded.
+type cacheEntry struct {
+	info    fs.FileInfo
+	stamp   string
+	checked time.Time
+	cost    int64
+	elem    *list.Element
+}
+
+// Stats returns the cache's counters
+func (c *CacheFS) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *CacheFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := c.load("open", name)
+	if err != nil {
+		return nil, err
+	}
+	// Too large to cache
+	if file == nil {
+		return c.fs.Open(name)
+	}
+	return &openFile{file, os.O_RDONLY, 0}, nil
+}
+
+func (c *CacheFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, err := c.get(name, false)
+	if err != nil {
+		return nil, err
+	}
+	return entry.info, nil
+}
+
+func (c *CacheFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := c.load("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return fs.ReadFile(c.fs, name)
+	} else if file.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDirectory}
+	}
+	// The caller may modify the data, so return a copy
+	data := make([]byte, len(file.Data))
+	copy(data, file.Data)
+	return data, nil
+}
+
+func (c *CacheFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := c.load("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return fs.ReadDir(c.fs, name)
+	} else if !file.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotADirectory}
+	}
+	des := make([]fs.DirEntry, len(file.Entries))
+	for i, de := range file.Entries {
+		des[i] = de
+	}
+	return des, nil
+}
+
+func (c *CacheFS) Lstat(name string) (fs.FileInfo, error) {
+	return lstat(c.fs, name)
+}
+
+func (c *CacheFS) Readlink(name string) (string, error) {
+	return readlink(c.fs, name)
+}
+
+// OpenFile opens the file in the underlying filesystem. Files opened for
+// writing invalidate the cache when they're opened and closed.
+func (c *CacheFS) OpenFile(name string, flag int, perm fs.FileMode) (RWFile, error) {
+	fsys, ok := c.fs.(FS)
+	if !ok {
+		if flag&writeFlags != 0 {
+			return nil, &fs.PathError{Op: "OpenFile", Path: name, Err: fs.ErrPermission}
+		}
+		file, err := c.fs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &readOnlyFile{file, name}, nil
+	}
+	if flag&writeFlags == 0 {
+		return fsys.OpenFile(name, flag, perm)
+	}
+	defer c.invalidate(name, false)
+	file, err := fsys.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheFile{file, c, name}, nil
+}
+
+func (c *CacheFS) MkdirAll(path string, perm fs.FileMode) error {
+	fsys, ok := c.fs.(FS)
+	if !ok {
+		return &fs.PathError{Op: "MkdirAll", Path: path, Err: fs.ErrPermission}
+	}
+	defer c.invalidate(path, false)
+	return fsys.MkdirAll(path, perm)
+}
+
+func (c *CacheFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	fsys, ok := c.fs.(FS)
+	if !ok {
+		return &fs.PathError{Op: "WriteFile", Path: name, Err: fs.ErrPermission}
+	}
+	defer c.invalidate(name, false)
+	return fsys.WriteFile(name, data, perm)
+}
+
+func (c *CacheFS) RemoveAll(path string) error {
+	fsys, ok := c.fs.(FS)
+	if !ok {
+		return &fs.PathError{Op: "RemoveAll", Path: path, Err: fs.ErrPermission}
+	}
+	defer c.invalidate(path, true)
+	return fsys.RemoveAll(path)
+}
+
+// load the file's data or directory entries into the cache. Returns a nil file
+// if it's too large to cache.
+func (c *CacheFS) load(op, name string) (*File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, err := c.get(name, true)
+	if err != nil {
+		return nil, err
+	} else if entry == nil {
+		return nil, nil
+	}
+	return c.tree[name], nil
+}
+
+// get the entry for name, revalidating or loading it when needed. When load is
+// true, the data or directory entries are loaded too.
+func (c *CacheFS) get(name string, load bool) (*cacheEntry, error) {
+	if entry, ok := c.entries[name]; ok && (!load || c.tree[name] != nil) && c.fresh(name, entry) {
+		c.stats.Hits++
+		c.lru.MoveToFront(entry.elem)
+		return entry, nil
+	}
+	c.stats.Misses++
+	c.remove(name)
+	info, err := fs.Stat(c.fs, name)
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{
+		info:    info,
+		stamp:   stampInfo(info.Size(), info.Mode(), info.ModTime()),
+		checked: Now(),
+		cost:    int64(len(name)),
+	}
+	if load {
+		// Too large to cache, so read through
+		if !info.IsDir() && entry.cost+info.Size() > c.budget {
+			return nil, nil
+		}
+		file, err := c.read(name, info)
+		if err != nil {
+			return nil, err
+		}
+		for _, de := range file.Entries {
+			entry.cost += int64(len(de.Path))
+		}
+		entry.cost += int64(len(file.Data))
+		c.tree[name] = file
+	}
+	entry.elem = c.lru.PushFront(name)
+	c.entries[name] = entry
+	c.stats.Bytes += entry.cost
+	c.evict()
+	return entry, nil
+}
+
+// fresh returns true if the entry still matches the underlying filesystem
+func (c *CacheFS) fresh(name string, entry *cacheEntry) bool {
+	now := Now()
+	if c.ttl > 0 && now.Sub(entry.checked) < c.ttl {
+		return true
+	}
+	info, err := fs.Stat(c.fs, name)
+	if err != nil || stampInfo(info.Size(), info.Mode(), info.ModTime()) != entry.stamp {
+		return false
+	}
+	entry.checked = now
+	return true
+}
+
+// read the file's data or directory entries from the underlying filesystem
+func (c *CacheFS) read(name string, info fs.FileInfo) (*File, error) {
+	file := &File{name, nil, info.Mode(), info.ModTime(), nil}
+	if !info.IsDir() {
+		data, err := fs.ReadFile(c.fs, name)
+		if err != nil {
+			return nil, err
+		}
+		file.Data = data
+		return file, nil
+	}
+	des, err := fs.ReadDir(c.fs, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, de := range des {
+		info, err := de.Info()
+		if err != nil {
+			return nil, err
+		}
+		file.Entries = append(file.Entries, &DirEntry{
+			Path:    path.Join(name, de.Name()),
+			Size:    info.Size(),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return file, nil
+}
+
+// evict the least recently used entries until the cache is within budget
+func (c *CacheFS) evict() {
+	for c.stats.Bytes > c.budget && c.lru.Len() > 1 {
+		c.remove(c.lru.Back().Value.(string))
+		c.stats.Evictions++
+	}
+}
+
+// remove the path from the cache
+func (c *CacheFS) remove(name string) {
+	entry, ok := c.entries[name]
+	if !ok {
+		return
+	}
+	c.lru.Remove(entry.elem)
+	delete(c.entries, name)
+	delete(c.tree, name)
+	c.stats.Bytes -= entry.cost
+}
+
+// invalidate the path and its parent directories, since their listings and
+// modification times change too. Also invalidates everything within the path
+// when subtree is true.
+func (c *CacheFS) invalidate(fpath string, subtree bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fpath = path.Clean(fpath)
+	if subtree {
+		prefix := fpath + "/"
+		for name := range c.entries {
+			if fpath == "." || strings.HasPrefix(name, prefix) {
+				c.remove(name)
+			}
+		}
+	}
+	for {
+		c.remove(fpath)
+		if fpath == "." {
+			return
+		}
+		fpath = path.Dir(fpath)
+	}
+}
+
+// cacheFile invalidates the cache after it's written to and closed
+type cacheFile struct {
+	RWFile
+	c    *CacheFS
+	name string
+}
+
+func (f *cacheFile) Close() error {
+	defer f.c.invalidate(f.name, false)
+	return f.RWFile.Close()
+}
@@ -0,0 +1,186 @@
+package virt_test
+
+import (
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+// countFS counts the files opened for reading
+type countFS struct {
+	virt.FS
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (c *countFS) Open(name string) (fs.File, error) {
+	c.mu.Lock()
+	c.opens[name]++
+	c.mu.Unlock()
+	return c.FS.Open(name)
+}
+
+func (c *countFS) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opens[name]
+}
+
+func TestCacheRead(t *testing.T) {
+	is := is.New(t)
+	under := &countFS{virt.Tree{
+		"a.txt":   &virt.File{Data: []byte("a"), Mode: 0644},
+		"b/b.txt": &virt.File{Data: []byte("b"), Mode: 0644},
+	}, sync.Mutex{}, map[string]int{}}
+	fsys := virt.Cache(under)
+	for i := 0; i < 3; i++ {
+		data, err := fs.ReadFile(fsys, "a.txt")
+		is.NoErr(err)
+		is.Equal(string(data), "a")
+	}
+	is.Equal(under.count("a.txt"), 1)
+	des, err := fs.ReadDir(fsys, "b")
+	is.NoErr(err)
+	is.Equal(len(des), 1)
+	is.Equal(des[0].Name(), "b.txt")
+	_, err = fs.ReadDir(fsys, "b")
+	is.NoErr(err)
+	stats := fsys.Stats()
+	is.Equal(stats.Hits, 3)
+	is.Equal(stats.Misses, 2)
+	is.True(stats.Bytes > 0)
+	// Errors aren't cached
+	_, err = fs.ReadFile(fsys, "c.txt")
+	is.True(err != nil)
+	is.NoErr(fstest.TestFS(fsys, "a.txt", "b/b.txt"))
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"a.txt": &virt.File{Data: []byte("a"), Mode: 0644},
+	}
+	fsys := virt.Cache(tree)
+	data, err := fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+	// Changed outside of the cache
+	tree["a.txt"] = &virt.File{Data: []byte("aa"), Mode: 0644}
+	data, err = fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "aa")
+	is.Equal(fsys.Stats().Misses, 2)
+	// Removed outside of the cache
+	delete(tree, "a.txt")
+	_, err = fsys.Stat("a.txt")
+	is.True(err != nil)
+}
+
+func TestCacheTTL(t *testing.T) {
+	is := is.New(t)
+	now := virt.Now
+	defer func() { virt.Now = now }()
+	clock := time.Date(2021, 8, 4, 14, 56, 0, 0, time.UTC)
+	virt.Now = func() time.Time { return clock }
+	tree := virt.Tree{
+		"a.txt": &virt.File{Data: []byte("a"), Mode: 0644},
+	}
+	fsys := virt.Cache(tree, virt.CacheTTL(time.Minute))
+	data, err := fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+	tree["a.txt"] = &virt.File{Data: []byte("aa"), Mode: 0644}
+	// Still within the TTL
+	data, err = fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+	clock = clock.Add(time.Minute)
+	data, err = fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "aa")
+}
+
+func TestCacheEvict(t *testing.T) {
+	is := is.New(t)
+	under := &countFS{virt.Tree{
+		"a.txt": &virt.File{Data: []byte("aaaaaaaaaa"), Mode: 0644},
+		"b.txt": &virt.File{Data: []byte("bbbbbbbbbb"), Mode: 0644},
+		"c.txt": &virt.File{Data: []byte("cccccccccccccccccccccccccccccc"), Mode: 0644},
+	}, sync.Mutex{}, map[string]int{}}
+	fsys := virt.Cache(under, virt.CacheSize(30))
+	for _, name := range []string{"a.txt", "b.txt", "a.txt"} {
+		_, err := fs.ReadFile(fsys, name)
+		is.NoErr(err)
+	}
+	is.Equal(under.count("a.txt"), 1)
+	is.Equal(fsys.Stats().Evictions, 0)
+	// Evicts b.txt, which was used least recently
+	_, err := fsys.Stat("c.txt")
+	is.NoErr(err)
+	is.Equal(fsys.Stats().Evictions, 1)
+	_, err = fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(under.count("a.txt"), 1)
+	_, err = fs.ReadFile(fsys, "b.txt")
+	is.NoErr(err)
+	is.Equal(under.count("b.txt"), 2)
+	is.True(fsys.Stats().Bytes <= 30)
+	// Files larger than the cache are read through
+	data, err := fs.ReadFile(fsys, "c.txt")
+	is.NoErr(err)
+	is.Equal(len(data), 30)
+	is.True(fsys.Stats().Bytes <= 30)
+}
+
+func TestCacheWriteInvalidates(t *testing.T) {
+	is := is.New(t)
+	now := virt.Now
+	defer func() { virt.Now = now }()
+	// The stamps won't change, so only invalidation picks up the writes
+	virt.Now = func() time.Time { return time.Date(2021, 8, 4, 14, 56, 0, 0, time.UTC) }
+	fsys := virt.Cache(virt.Tree{
+		"a.txt": &virt.File{Data: []byte("a"), Mode: 0644},
+	}, virt.CacheTTL(time.Hour))
+	des, err := fs.ReadDir(fsys, ".")
+	is.NoErr(err)
+	is.Equal(len(des), 1)
+	data, err := fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+	is.NoErr(fsys.WriteFile("a.txt", []byte("b"), 0644))
+	data, err = fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "b")
+	is.NoErr(fsys.WriteFile("b/b.txt", []byte("b"), 0644))
+	des, err = fs.ReadDir(fsys, ".")
+	is.NoErr(err)
+	is.Equal(len(des), 2)
+	is.NoErr(fsys.RemoveAll("b"))
+	_, err = fsys.Stat("b/b.txt")
+	is.True(err != nil)
+	// Writes through open files
+	file, err := fsys.OpenFile("a.txt", os.O_WRONLY, 0644)
+	is.NoErr(err)
+	_, err = file.Write([]byte("c"))
+	is.NoErr(err)
+	is.NoErr(file.Close())
+	data, err = fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "c")
+}
+
+func TestCacheReadOnly(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.Cache(virt.Map{"a.txt": "a"})
+	data, err := fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+	err = fsys.WriteFile("a.txt", []byte("b"), 0644)
+	is.True(err != nil)
+}
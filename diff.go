@@ -0,0 +1,429 @@
+package virt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Diff compares two filesystems at subpath and returns the changes needed to
+// turn from into to, sorted by path. Contents, modes and symlink targets are
+// compared, but modification times are not. Missing permissions are treated as
+// 0644 for files and 0755 for directories, like WriteFS.
+func Diff(from, to fs.FS, subpaths ...string) (Changes, error) {
+	dir := path.Join(subpaths...)
+	if dir == "" {
+		dir = "."
+	}
+	changes, err := diffDir(from, to, dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// ChangeType is the type of change between two filesystems
+type ChangeType uint8
+
+const (
+	Added ChangeType = iota + 1
+	Removed
+	Modified
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	default:
+		return ""
+	}
+}
+
+// Change to a path between two filesystems. From is nil when the path was
+// added and To is nil when the path was removed.
+type Change struct {
+	Type ChangeType
+	Path string
+	From *File
+	To   *File
+}
+
+// ModeChanged returns true if the mode of a modified path changed
+func (c *Change) ModeChanged() bool {
+	return c.From != nil && c.To != nil && normalMode(c.From) != normalMode(c.To)
+}
+
+// DataChanged returns true if the contents or symlink target of a modified path
+// changed
+func (c *Change) DataChanged() bool {
+	return c.From != nil && c.To != nil && !bytes.Equal(c.From.Data, c.To.Data)
+}
+
+// Binary returns true if either side of the change is a binary file
+func (c *Change) Binary() bool {
+	return (c.From != nil && isBinary(c.From)) || (c.To != nil && isBinary(c.To))
+}
+
+// String returns the change in the unified diff format
+func (c *Change) String() string {
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "diff a/%s b/%s\n", c.Path, c.Path)
+	switch c.Type {
+	case Added:
+		fmt.Fprintf(out, "new mode %s\n", normalMode(c.To))
+	case Removed:
+		fmt.Fprintf(out, "deleted mode %s\n", normalMode(c.From))
+	case Modified:
+		if c.ModeChanged() {
+			fmt.Fprintf(out, "old mode %s\n", normalMode(c.From))
+			fmt.Fprintf(out, "new mode %s\n", normalMode(c.To))
+		}
+	}
+	from, to := c.From, c.To
+	// Directories don't have contents to compare
+	if (from == nil || from.IsDir()) && (to == nil || to.IsDir()) {
+		return out.String()
+	}
+	if c.Type == Modified && !c.DataChanged() {
+		return out.String()
+	}
+	fromName, toName := "a/"+c.Path, "b/"+c.Path
+	if c.Type == Added {
+		fromName = "/dev/null"
+	} else if c.Type == Removed {
+		toName = "/dev/null"
+	}
+	if c.Binary() {
+		fmt.Fprintf(out, "Binary files %s and %s differ\n", fromName, toName)
+		return out.String()
+	}
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", fromName, toName)
+	out.WriteString(unifiedHunks(diffLines(splitLines(from), splitLines(to)), 3))
+	return out.String()
+}
+
+// Changes between two filesystems
+type Changes []*Change
+
+// String returns all the changes in the unified diff format
+func (changes Changes) String() string {
+	out := new(strings.Builder)
+	for _, change := range changes {
+		out.WriteString(change.String())
+	}
+	return out.String()
+}
+
+func diffDir(from, to fs.FS, dir string) (changes Changes, err error) {
+	fromEntries, err := fs.ReadDir(from, dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	toEntries, err := fs.ReadDir(to, dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	fromSet := newSet(fromEntries)
+	toSet := newSet(toEntries)
+	for _, de := range toSet.Difference(fromSet) {
+		added, err := fromFS(to, path.Join(dir, de.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range added {
+			changes = append(changes, &Change{Type: Added, Path: file.Path, To: file})
+		}
+	}
+	for _, de := range fromSet.Difference(toSet) {
+		removed, err := fromFS(from, path.Join(dir, de.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range removed {
+			changes = append(changes, &Change{Type: Removed, Path: file.Path, From: file})
+		}
+	}
+	for _, de := range fromSet.Intersection(toSet) {
+		fpath := path.Join(dir, de.Name())
+		fromFile, err := fromDirEntry(from, fpath, de)
+		if err != nil {
+			return nil, err
+		}
+		toFile, err := fromDirEntry(to, fpath, toSet[de.Name()])
+		if err != nil {
+			return nil, err
+		}
+		// Replacing a directory with a file or vice versa removes the old path
+		// and everything within it, then adds the new path.
+		if fromFile.IsDir() != toFile.IsDir() {
+			removed, err := fromFS(from, fpath)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range removed {
+				changes = append(changes, &Change{Type: Removed, Path: file.Path, From: file})
+			}
+			added, err := fromFS(to, fpath)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range added {
+				changes = append(changes, &Change{Type: Added, Path: file.Path, To: file})
+			}
+			continue
+		}
+		change := &Change{Type: Modified, Path: fpath, From: fromFile, To: toFile}
+		if change.ModeChanged() || change.DataChanged() {
+			changes = append(changes, change)
+		}
+		if !fromFile.IsDir() {
+			continue
+		}
+		childChanges, err := diffDir(from, to, fpath)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, childChanges...)
+	}
+	return changes, nil
+}
+
+// normalMode fills in the default permissions when they're missing
+func normalMode(file *File) fs.FileMode {
+	if file.Mode.Perm() != 0 {
+		return file.Mode
+	}
+	switch {
+	case file.IsDir():
+		return file.Mode | 0755
+	case file.Mode&fs.ModeSymlink != 0:
+		return file.Mode | 0777
+	default:
+		return file.Mode | 0644
+	}
+}
+
+// isBinary returns true if the file contains a NUL byte or invalid UTF-8 in
+// the first 8000 bytes, similar to git.
+func isBinary(file *File) bool {
+	data := file.Data
+	if len(data) > 8000 {
+		data = data[:8000]
+		// Don't split a multibyte character in half
+		for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.RuneStart(file.Data[len(data)]); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+// splitLines splits the file's data into lines, keeping the newlines
+func splitLines(file *File) (lines []string) {
+	if file == nil || len(file.Data) == 0 {
+		return nil
+	}
+	data := string(file.Data)
+	for len(data) > 0 {
+		i := strings.IndexByte(data, '\n')
+		if i < 0 {
+			lines = append(lines, data)
+			break
+		}
+		lines = append(lines, data[:i+1])
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// lineOp is a line in an edit script. Kind is ' ' for an unchanged line, '-'
+// for a removed line and '+' for an added line.
+type lineOp struct {
+	kind byte
+	line string
+}
+
+// maxDiffEdits is the most edits diffLines searches for before giving up and
+// replacing the changed lines wholesale. Backtracking keeps O(D²) state, so this
+// bounds the memory used on files that are completely different.
+const maxDiffEdits = 1000
+
+// diffLines computes the shortest edit script between a and b using the
+// Myers diff algorithm. If the files differ by more than maxDiffEdits lines,
+// the lines between the common prefix and suffix are removed and added
+// instead.
+func diffLines(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxDiffEdits {
+		max = maxDiffEdits
+	}
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v[-d:d] before step d, which is all backtracking needs
+	var trace [][]int
+	var d int
+search:
+	for d = 0; ; d++ {
+		if d > max {
+			return replaceLines(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+	// Backtrack through the trace to build the edit script in reverse
+	var ops []lineOp
+	x, y := n, m
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, lineOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, lineOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, lineOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, lineOp{' ', a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// replaceLines is an edit script that keeps the common prefix and suffix of a
+// and b, and replaces everything in between.
+func replaceLines(a, b []string) (ops []lineOp) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, line := range a[:prefix] {
+		ops = append(ops, lineOp{' ', line})
+	}
+	for _, line := range a[prefix : len(a)-suffix] {
+		ops = append(ops, lineOp{'-', line})
+	}
+	for _, line := range b[prefix : len(b)-suffix] {
+		ops = append(ops, lineOp{'+', line})
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, lineOp{' ', line})
+	}
+	return ops
+}
+
+// unifiedHunks formats the edit script as unified diff hunks with the given
+// lines of context.
+func unifiedHunks(ops []lineOp, context int) string {
+	out := new(strings.Builder)
+	for i := 0; i < len(ops); {
+		// Find the next change
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk until there's more than twice the context unchanged
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		end += context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		// Count the lines before and within the hunk
+		fromLine, toLine := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				fromLine++
+			}
+			if op.kind != '-' {
+				toLine++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				fromCount++
+			}
+			if op.kind != '-' {
+				toCount++
+			}
+		}
+		if fromCount == 0 {
+			fromLine--
+		}
+		if toCount == 0 {
+			toLine--
+		}
+		fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount)
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
@@ -0,0 +1,155 @@
+package virt_test
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestDiff(t *testing.T) {
+	is := is.New(t)
+	from := virt.Tree{
+		"a.txt":       &virt.File{Data: []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")},
+		"removed.txt": &virt.File{Data: []byte("removed\n")},
+		"run.sh":      &virt.File{Data: []byte("#!/bin/sh\n"), Mode: 0644},
+		"link.txt":    &virt.File{Data: []byte("a.txt"), Mode: 0777 | fs.ModeSymlink},
+		"same.txt":    &virt.File{Data: []byte("same")},
+		"image.png":   &virt.File{Data: []byte{0x89, 'P', 'N', 'G', 0}},
+	}
+	to := virt.Tree{
+		"a.txt":       &virt.File{Data: []byte("1\n2\n3\nfour\n5\n6\n7\n8\n9\n10")},
+		"new/new.txt": &virt.File{Data: []byte("new\n")},
+		"run.sh":      &virt.File{Data: []byte("#!/bin/sh\n"), Mode: 0755},
+		"link.txt":    &virt.File{Data: []byte("same.txt"), Mode: 0777 | fs.ModeSymlink},
+		"same.txt":    &virt.File{Data: []byte("same"), Mode: 0644},
+		"image.png":   &virt.File{Data: []byte{0x89, 'P', 'N', 'G', 1}},
+	}
+	changes, err := virt.Diff(from, to)
+	is.NoErr(err)
+	is.Equal(len(changes), 7)
+	is.Equal(changes[0].Path, "a.txt")
+	is.Equal(changes[0].Type, virt.Modified)
+	is.Equal(changes[1].Path, "image.png")
+	is.True(changes[1].Binary())
+	is.Equal(changes[2].Path, "link.txt")
+	is.True(changes[2].DataChanged())
+	is.Equal(changes[3].Path, "new")
+	is.Equal(changes[3].Type, virt.Added)
+	is.Equal(changes[4].Path, "new/new.txt")
+	is.Equal(changes[4].Type, virt.Added)
+	is.Equal(changes[5].Path, "removed.txt")
+	is.Equal(changes[5].Type, virt.Removed)
+	is.Equal(changes[6].Path, "run.sh")
+	is.True(changes[6].ModeChanged())
+	is.True(!changes[6].DataChanged())
+	is.Equal(changes.String(), `diff a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,10 +1,10 @@
+ 1
+ 2
+ 3
+-4
++four
+ 5
+ 6
+ 7
+ 8
+ 9
+-10
++10
+\ No newline at end of file
+diff a/image.png b/image.png
+Binary files a/image.png and b/image.png differ
+diff a/link.txt b/link.txt
+--- a/link.txt
++++ b/link.txt
+@@ -1,1 +1,1 @@
+-a.txt
+\ No newline at end of file
++same.txt
+\ No newline at end of file
+diff a/new b/new
+new mode drwxr-xr-x
+diff a/new/new.txt b/new/new.txt
+new mode -rw-r--r--
+--- /dev/null
++++ b/new/new.txt
+@@ -0,0 +1,1 @@
++new
+diff a/removed.txt b/removed.txt
+deleted mode -rw-r--r--
+--- a/removed.txt
++++ /dev/null
+@@ -1,1 +0,0 @@
+-removed
+diff a/run.sh b/run.sh
+old mode -rw-r--r--
+new mode -rwxr-xr-x
+`)
+}
+
+func TestDiffHunks(t *testing.T) {
+	is := is.New(t)
+	from := virt.Map{
+		"a.txt": "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n18\n19\n20\n",
+	}
+	to := virt.Map{
+		"a.txt": "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n18\n19\n20\n21\n",
+	}
+	changes, err := virt.Diff(from, to)
+	is.NoErr(err)
+	is.Equal(changes.String(), `diff a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -18,3 +18,4 @@
+ 18
+ 19
+ 20
++21
+`)
+}
+
+func TestDiffLarge(t *testing.T) {
+	is := is.New(t)
+	// Too many edits to search for, so the middle is replaced wholesale
+	from, to := new(strings.Builder), new(strings.Builder)
+	from.WriteString("first\n")
+	to.WriteString("first\n")
+	for i := 0; i < 2000; i++ {
+		from.WriteString("from " + strconv.Itoa(i) + "\n")
+		to.WriteString("to " + strconv.Itoa(i) + "\n")
+	}
+	from.WriteString("last\n")
+	to.WriteString("last\n")
+	changes, err := virt.Diff(virt.Map{"a.txt": from.String()}, virt.Map{"a.txt": to.String()})
+	is.NoErr(err)
+	out := changes.String()
+	is.True(strings.HasPrefix(out, "diff a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2002 +1,2002 @@\n first\n-from 0\n-from 1\n"))
+	is.True(strings.Contains(out, "-from 1999\n+to 0\n"))
+	is.True(strings.HasSuffix(out, "+to 1999\n last\n"))
+}
+
+func TestDiffEqual(t *testing.T) {
+	is := is.New(t)
+	from := virt.Map{"a.txt": "a", "b/b.txt": "b"}
+	to := virt.Tree{
+		"a.txt":   &virt.File{Data: []byte("a"), Mode: 0644},
+		"b":       &virt.File{Mode: 0755 | fs.ModeDir},
+		"b/b.txt": &virt.File{Data: []byte("b"), Mode: 0644},
+	}
+	changes, err := virt.Diff(from, to)
+	is.NoErr(err)
+	is.Equal(len(changes), 0)
+	is.Equal(changes.String(), "")
+}
@@ -1,39 +1,351 @@
 package virt
 
 import (
+	"errors"
+	"io"
 	"io/fs"
+	"os"
 	"path"
+	"strings"
 )
 
-func Exclude(fsys fs.FS, fn func(path string) bool) fs.FS {
-	return &exclude{fsys, fn}
+// Matcher reports whether a path matches. Paths are slash-separated and
+// relative to the root of the filesystem.
+type Matcher func(path string) bool
+
+// Exclude paths that match from the filesystem. Children of excluded
+// directories are excluded too, and so are paths that resolve into an excluded
+// path through symlinks.
+func Exclude(fsys fs.FS, fn Matcher) fs.FS {
+	return &exclude{fsys, fn, nil}
 }
 
 type exclude struct {
 	fs.FS
-	fn func(path string) bool
+	fn Matcher
+	// entries optionally returns a matcher for the entries of a directory, so
+	// filters that depend on a directory's contents can scan it once per listing
+	entries func(dir string) Matcher
+}
+
+var _ fs.StatFS = (*exclude)(nil)
+var _ fs.ReadDirFS = (*exclude)(nil)
+var _ fs.ReadFileFS = (*exclude)(nil)
+var _ fs.GlobFS = (*exclude)(nil)
+
+func (e *exclude) Open(name string) (fs.File, error) {
+	if err := e.check("open", name, true); err != nil {
+		return nil, err
+	}
+	file, err := e.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !stat.IsDir() {
+		return file, nil
+	}
+	// Wrap directories so that reading the directory filters out excluded paths
+	return &excludeDir{file, name, e, nil}, nil
+}
+
+func (e *exclude) Stat(name string) (fs.FileInfo, error) {
+	if err := e.check("stat", name, true); err != nil {
+		return nil, err
+	}
+	return fs.Stat(e.FS, name)
+}
+
+func (e *exclude) Lstat(name string) (fs.FileInfo, error) {
+	if err := e.check("lstat", name, false); err != nil {
+		return nil, err
+	}
+	return lstat(e.FS, name)
 }
 
-func (e *exclude) Open(path string) (fs.File, error) {
-	if e.fn(path) {
-		return nil, fs.ErrNotExist
+func (e *exclude) ReadFile(name string) ([]byte, error) {
+	if err := e.check("readfile", name, true); err != nil {
+		return nil, err
 	}
-	return e.FS.Open(path)
+	return fs.ReadFile(e.FS, name)
 }
 
 func (e *exclude) ReadDir(dir string) (results []fs.DirEntry, err error) {
-	if e.fn(dir) {
-		return nil, fs.ErrNotExist
+	if err := e.check("readdir", dir, true); err != nil {
+		return nil, err
 	}
 	des, err := fs.ReadDir(e.FS, dir)
 	if err != nil {
 		return nil, err
 	}
+	return e.filter(e.matcher(dir), dir, des), nil
+}
+
+func (e *exclude) Glob(pattern string) (matches []string, err error) {
+	// Check the pattern before matching, like fs.Glob
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	paths, err := fs.Glob(e.FS, pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, fpath := range paths {
+		if e.excluded(fpath) {
+			continue
+		}
+		matches = append(matches, fpath)
+	}
+	return matches, nil
+}
+
+// check that the path is valid and isn't excluded, even through symlinks. The
+// last element is only followed when follow is true.
+func (e *exclude) check(op, name string, follow bool) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if e.excluded(name) || e.linksExcluded(name, follow) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+// excluded returns true if the path or any of its parents match
+func (e *exclude) excluded(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' && e.fn(name[:i]) {
+			return true
+		}
+	}
+	return e.fn(name)
+}
+
+// linksExcluded returns true if resolving the symlinks in name passes through
+// an excluded path, so links can't be used to reach excluded content. Links
+// that can't be resolved are left to the underlying filesystem to report.
+func (e *exclude) linksExcluded(name string, follow bool) bool {
+	if _, ok := e.FS.(lstatFS); !ok {
+		return false
+	}
+	resolved, rest := ".", name
+	for links := 0; rest != ""; {
+		elem, remaining, _ := strings.Cut(rest, "/")
+		next := path.Join(resolved, elem)
+		if remaining == "" && !follow {
+			return e.excluded(next)
+		}
+		info, err := lstat(e.FS, next)
+		if err != nil {
+			return e.excluded(next)
+		} else if info.Mode()&fs.ModeSymlink == 0 {
+			resolved, rest = next, remaining
+			continue
+		}
+		link, err := readlink(e.FS, next)
+		if err != nil {
+			return false
+		}
+		target := path.Join(path.Dir(next), link)
+		if strings.HasPrefix(link, "/") || !fs.ValidPath(target) {
+			return false
+		} else if e.excluded(target) {
+			return true
+		}
+		if links++; links > maxSymlinks {
+			return false
+		}
+		// Resolve the rest of the path from the link's target
+		resolved, rest = ".", target
+		if remaining != "" {
+			rest = target + "/" + remaining
+		}
+	}
+	return e.excluded(resolved)
+}
+
+// matcher returns the matcher for the entries within dir
+func (e *exclude) matcher(dir string) Matcher {
+	if e.entries != nil {
+		return e.entries(dir)
+	}
+	return e.fn
+}
+
+// filter out the excluded entries within dir
+func (e *exclude) filter(fn Matcher, dir string, des []fs.DirEntry) (results []fs.DirEntry) {
 	for _, de := range des {
-		if e.fn(path.Join(dir, de.Name())) {
+		if fn(path.Join(dir, de.Name())) {
 			continue
 		}
 		results = append(results, de)
 	}
+	return results
+}
+
+// excludeDir is an opened directory that filters out excluded entries
+type excludeDir struct {
+	fs.File
+	path  string
+	e     *exclude
+	match Matcher // Created on the first read
+}
+
+var _ fs.ReadDirFile = (*excludeDir)(nil)
+
+func (d *excludeDir) ReadDir(count int) (results []fs.DirEntry, err error) {
+	dir, ok := d.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: d.path, Err: errNotADirectory}
+	}
+	if d.match == nil {
+		d.match = d.e.matcher(d.path)
+	}
+	if count <= 0 {
+		des, err := dir.ReadDir(count)
+		if err != nil {
+			return nil, err
+		}
+		return d.e.filter(d.match, d.path, des), nil
+	}
+	// Keep reading until we have count entries or reach the end
+	for len(results) < count {
+		des, err := dir.ReadDir(count - len(results))
+		results = append(results, d.e.filter(d.match, d.path, des)...)
+		if err != nil {
+			if err == io.EOF && len(results) > 0 {
+				return results, nil
+			}
+			return results, err
+		}
+	}
 	return results, nil
 }
+
+func (d *excludeDir) Write(p []byte) (int, error) {
+	if w, ok := d.File.(io.Writer); ok {
+		return w.Write(p)
+	}
+	return 0, &fs.PathError{Op: "write", Path: d.path, Err: fs.ErrInvalid}
+}
+
+// ExcludeFS is like Exclude, but preserves the writable FS interface. Writes to
+// excluded paths fail with fs.ErrPermission. Removing a directory leaves its
+// excluded children alone.
+func ExcludeFS(fsys FS, fn Matcher) FS {
+	return &excludeFS{&exclude{fsys, fn, nil}, fsys}
+}
+
+type excludeFS struct {
+	*exclude
+	fsys FS
+}
+
+var _ FS = (*excludeFS)(nil)
+
+func (e *excludeFS) Readlink(name string) (string, error) {
+	if err := e.check("readlink", name, false); err != nil {
+		return "", err
+	}
+	return e.fsys.Readlink(name)
+}
+
+func (e *excludeFS) OpenFile(name string, flag int, perm fs.FileMode) (RWFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "openfile", Path: name, Err: fs.ErrInvalid}
+	}
+	if e.excluded(name) || e.linksExcluded(name, true) {
+		// Excluded files don't exist to readers, but can't be created by writers
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+			return nil, &fs.PathError{Op: "openfile", Path: name, Err: fs.ErrPermission}
+		}
+		return nil, &fs.PathError{Op: "openfile", Path: name, Err: fs.ErrNotExist}
+	}
+	file, err := e.fsys.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !stat.IsDir() {
+		return file, nil
+	}
+	return &excludeDir{file, name, e.exclude, nil}, nil
+}
+
+func (e *excludeFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := e.checkWrite("MkdirAll", name, true); err != nil {
+		return err
+	}
+	return e.fsys.MkdirAll(name, perm)
+}
+
+func (e *excludeFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := e.checkWrite("WriteFile", name, true); err != nil {
+		return err
+	}
+	return e.fsys.WriteFile(name, data, perm)
+}
+
+func (e *excludeFS) RemoveAll(name string) error {
+	if err := e.checkWrite("RemoveAll", name, false); err != nil {
+		return err
+	}
+	_, err := e.removeAll(name)
+	return err
+}
+
+// checkWrite checks that the path is valid and can be written to, even through
+// symlinks. The last element is only followed when follow is true.
+func (e *excludeFS) checkWrite(op, name string, follow bool) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if e.excluded(name) || e.linksExcluded(name, follow) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+// removeAll removes the path, keeping any excluded paths within it. Returns
+// true if anything was kept.
+func (e *excludeFS) removeAll(name string) (kept bool, err error) {
+	info, err := e.fsys.Lstat(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !info.IsDir() {
+		return false, e.fsys.RemoveAll(name)
+	}
+	des, err := fs.ReadDir(e.fsys, name)
+	if err != nil {
+		return false, err
+	}
+	for _, de := range des {
+		child := path.Join(name, de.Name())
+		if e.fn(child) {
+			kept = true
+			continue
+		}
+		childKept, err := e.removeAll(child)
+		if err != nil {
+			return false, err
+		}
+		kept = kept || childKept
+	}
+	// Never remove the root directory itself
+	if kept || name == "." {
+		return kept, nil
+	}
+	return false, e.fsys.RemoveAll(name)
+}
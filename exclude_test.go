@@ -1,9 +1,14 @@
 package virt_test
 
 import (
+	"errors"
+	"io"
 	"io/fs"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/matryer/is"
 	"github.com/matthewmueller/virt"
@@ -24,3 +29,166 @@ func TestExclude(t *testing.T) {
 	is.Equal(len(des), 1)
 	is.Equal(des[0].Name(), "view")
 }
+
+func TestExcludeOpenDir(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"view/a.txt": &virt.File{Data: []byte("a")},
+		"view/b.txt": &virt.File{Data: []byte("b")},
+		"view/c.txt": &virt.File{Data: []byte("c")},
+		"bud/bud.go": &virt.File{Data: []byte("bud")},
+	}
+	fsys := virt.Exclude(tree, func(path string) bool {
+		return path == "bud" || path == "view/b.txt"
+	})
+	file, err := fsys.Open("view")
+	is.NoErr(err)
+	defer file.Close()
+	dir, ok := file.(fs.ReadDirFile)
+	is.True(ok)
+	des, err := dir.ReadDir(1)
+	is.NoErr(err)
+	is.Equal(len(des), 1)
+	is.Equal(des[0].Name(), "a.txt")
+	des, err = dir.ReadDir(1)
+	is.NoErr(err)
+	is.Equal(len(des), 1)
+	is.Equal(des[0].Name(), "c.txt")
+	des, err = dir.ReadDir(1)
+	is.Equal(err, io.EOF)
+	is.Equal(len(des), 0)
+}
+
+func TestExcludeAccess(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"view/a.txt": &virt.File{Data: []byte("a")},
+		"view/b.txt": &virt.File{Data: []byte("b")},
+		"bud/bud.go": &virt.File{Data: []byte("bud")},
+	}
+	fsys := virt.Exclude(tree, func(path string) bool {
+		return path == "bud" || path == "view/b.txt"
+	})
+	// Children of excluded directories are excluded too
+	_, err := fs.Stat(fsys, "bud/bud.go")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	_, err = fs.ReadFile(fsys, "bud/bud.go")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	_, err = fs.Stat(fsys, "view/b.txt")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	data, err := fs.ReadFile(fsys, "view/a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+	lstat, ok := fsys.(interface {
+		Lstat(name string) (fs.FileInfo, error)
+	})
+	is.True(ok)
+	_, err = lstat.Lstat("view/b.txt")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	matches, err := fs.Glob(fsys, "*/*")
+	is.NoErr(err)
+	is.Equal(matches, []string{"view/a.txt"})
+	is.NoErr(fstest.TestFS(fsys, "view/a.txt"))
+}
+
+func TestExcludeSymlink(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"view/a.txt":     &virt.File{Data: []byte("a")},
+		"secret/key.txt": &virt.File{Data: []byte("key")},
+		"key.txt":        &virt.File{Data: []byte("secret/key.txt"), Mode: fs.ModeSymlink | 0777},
+		"view/up":        &virt.File{Data: []byte("../secret"), Mode: fs.ModeSymlink | 0777},
+		"a.txt":          &virt.File{Data: []byte("view/a.txt"), Mode: fs.ModeSymlink | 0777},
+	}
+	fsys := virt.ExcludeFS(tree, func(path string) bool {
+		return path == "secret"
+	})
+	// Symlinks can't be used to reach excluded paths
+	_, err := fs.ReadFile(fsys, "key.txt")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	_, err = fs.Stat(fsys, "key.txt")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	_, err = fsys.Open("view/up/key.txt")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	_, err = fs.ReadDir(fsys, "view/up")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	err = fsys.WriteFile("view/up/new.txt", []byte("new"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	// The links themselves are still visible
+	info, err := fsys.Lstat("key.txt")
+	is.NoErr(err)
+	is.True(info.Mode()&fs.ModeSymlink != 0)
+	link, err := fsys.Readlink("key.txt")
+	is.NoErr(err)
+	is.Equal(link, "secret/key.txt")
+	// Links to paths that aren't excluded still work
+	data, err := fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+}
+
+func TestExcludeFSWrite(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"view/a.txt":   &virt.File{Data: []byte("a")},
+		"view/.secret": &virt.File{Data: []byte("secret")},
+		"bud/bud.go":   &virt.File{Data: []byte("bud")},
+	}
+	fsys := virt.ExcludeFS(tree, func(path string) bool {
+		return path == "bud" || strings.HasSuffix(path, ".secret")
+	})
+	// Writes to included paths are forwarded
+	is.NoErr(fsys.WriteFile("view/b.txt", []byte("b"), 0644))
+	is.Equal(string(tree["view/b.txt"].Data), "b")
+	is.NoErr(fsys.MkdirAll("view/c", 0755))
+	// Writes to excluded paths are rejected
+	err := fsys.WriteFile("bud/main.go", []byte("main"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	err = fsys.WriteFile("view/.secret", []byte("overwrite"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	is.Equal(string(tree["view/.secret"].Data), "secret")
+	err = fsys.MkdirAll("bud/dir", 0755)
+	is.True(errors.Is(err, fs.ErrPermission))
+	_, err = fsys.OpenFile("bud/bud.go", os.O_RDWR, 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	_, err = fsys.OpenFile("bud/bud.go", os.O_RDONLY, 0)
+	is.True(errors.Is(err, fs.ErrNotExist))
+	err = fsys.RemoveAll("bud")
+	is.True(errors.Is(err, fs.ErrPermission))
+	// Removing a directory leaves the excluded children alone
+	is.NoErr(fsys.RemoveAll("view"))
+	_, ok := tree["view/a.txt"]
+	is.True(!ok)
+	_, ok = tree["view/b.txt"]
+	is.True(!ok)
+	_, ok = tree["view/.secret"]
+	is.True(ok)
+	_, ok = tree["bud/bud.go"]
+	is.True(ok)
+}
+
+func TestExcludeFSSync(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\n"), 0644))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "old.txt"), []byte("old"), 0644))
+	is.NoErr(os.MkdirAll(filepath.Join(dir, "logs"), 0755))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "logs", "debug.log"), []byte("debug"), 0644))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "logs", "old.txt"), []byte("old"), 0644))
+	target := virt.OS(dir)
+	from := virt.Tree{
+		".gitignore": &virt.File{Data: []byte("*.log\n"), Mode: 0644},
+		"new.txt":    &virt.File{Data: []byte("new"), Mode: 0644},
+	}
+	is.NoErr(virt.SyncFS(from, virt.ExcludeFS(target, virt.Gitignore(target))))
+	data, err := os.ReadFile(filepath.Join(dir, "new.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "new")
+	_, err = os.Stat(filepath.Join(dir, "old.txt"))
+	is.True(errors.Is(err, fs.ErrNotExist))
+	_, err = os.Stat(filepath.Join(dir, "logs", "old.txt"))
+	is.True(errors.Is(err, fs.ErrNotExist))
+	data, err = os.ReadFile(filepath.Join(dir, "logs", "debug.log"))
+	is.NoErr(err)
+	is.Equal(string(data), "debug")
+}
@@ -5,6 +5,7 @@ import (
 	"hash"
 	"io"
 	"io/fs"
+	"os"
 	"path"
 	"strconv"
 	"strings"
@@ -128,13 +129,32 @@ func (f *openFile) Close() error {
 }
 
 func (f *openFile) Write(p []byte) (int, error) {
-	// TODO: throw an error if the file is not writable
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.Path, Err: errBadFileDescriptor}
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.Data))
+	}
+	// Grow the data when writing past the end
+	end := f.offset + int64(len(p))
+	if end > int64(len(f.Data)) {
+		data := make([]byte, end)
+		copy(data, f.Data)
+		f.Data = data
+	}
 	n := copy(f.Data[f.offset:], p)
 	f.offset += int64(n)
+	f.ModTime = Now()
 	return n, nil
 }
 
 func (f *openFile) Read(b []byte) (int, error) {
+	if f.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.Path, Err: errIsDirectory}
+	}
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.Path, Err: errBadFileDescriptor}
+	}
 	if f.offset >= int64(len(f.Data)) {
 		return 0, io.EOF
 	}
@@ -167,6 +187,70 @@ func (f *openFile) Seek(offset int64, whence int) (int64, error) {
 }
 
 var errNotADirectory = errors.New("not a directory")
+var errIsDirectory = errors.New("is a directory")
+var errBadFileDescriptor = errors.New("bad file descriptor")
+
+// openTarget opens the file that name resolved to. Like os.Open, files opened
+// for reading through a symlink keep the name of the link.
+func openTarget(op, name string, target *File, flag int) (*openFile, error) {
+	f, err := openFlag(op, target, flag)
+	if err != nil {
+		return nil, err
+	}
+	if target.Path != name && flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		renamed := *target
+		renamed.Path = name
+		f.File = &renamed
+	}
+	return f, nil
+}
+
+// followSymlinks follows symlinks in the last element of name. Like symlinks on
+// disk, link targets are relative to the directory containing the link.
+func followSymlinks(op, name string, lookup func(name string) (*File, bool)) (string, error) {
+	for links := 0; links <= maxSymlinks; links++ {
+		file, ok := lookup(name)
+		if !ok || file.Mode&fs.ModeSymlink == 0 {
+			return name, nil
+		}
+		link := string(file.Data)
+		target := path.Join(path.Dir(name), link)
+		if strings.HasPrefix(link, "/") || !fs.ValidPath(target) {
+			return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		name = target
+	}
+	return "", &fs.PathError{Op: op, Path: name, Err: errTooManySymlinks}
+}
+
+// checkParents returns an error if any parent of name is not a directory
+func checkParents(op, name string, lookup func(name string) (*File, bool)) error {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if file, ok := lookup(dir); ok && !file.IsDir() {
+			return &fs.PathError{Op: op, Path: name, Err: errNotADirectory}
+		}
+	}
+	return nil
+}
+
+// openFlag opens an existing file with the OpenFile flags. Only O_CREATE,
+// O_EXCL, O_TRUNC and O_APPEND are supported, along with the access modes.
+func openFlag(op string, file *File, flag int) (*openFile, error) {
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, &fs.PathError{Op: op, Path: file.Path, Err: fs.ErrExist}
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return &openFile{file, flag, 0}, nil
+	}
+	if file.IsDir() {
+		return nil, &fs.PathError{Op: op, Path: file.Path, Err: errIsDirectory}
+	}
+	if flag&os.O_TRUNC != 0 {
+		file.Data = nil
+		file.ModTime = Now()
+	}
+	return &openFile{file, flag, 0}, nil
+}
 
 func (f *openFile) ReadDir(count int) ([]fs.DirEntry, error) {
 	if !f.IsDir() {
@@ -118,3 +118,55 @@ func fromFile(path string, file fs.File, stat fs.FileInfo) (entry *File, err err
 		Mode:    stat.Mode(),
 	}, nil
 }
+
+// fromFS reads every file and directory within dir into a list in lexical
+// order. Symlinks are stored as links rather than followed.
+func fromFS(fsys fs.FS, dir string) (list List, err error) {
+	err = fs.WalkDir(fsys, dir, func(fpath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if fpath == "." {
+			return nil
+		}
+		file, err := fromDirEntry(fsys, fpath, de)
+		if err != nil {
+			return err
+		}
+		list = append(list, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// fromDirEntry reads a directory entry into a file. Directories are read
+// without their entries and symlinks are stored as links.
+func fromDirEntry(fsys fs.FS, fpath string, de fs.DirEntry) (*File, error) {
+	info, err := de.Info()
+	if err != nil {
+		return nil, err
+	}
+	file := &File{
+		Path:    fpath,
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+	switch {
+	case de.IsDir():
+	case info.Mode()&fs.ModeSymlink != 0:
+		link, err := readlink(fsys, fpath)
+		if err != nil {
+			return nil, err
+		}
+		file.Data = []byte(link)
+	default:
+		data, err := fs.ReadFile(fsys, fpath)
+		if err != nil {
+			return nil, err
+		}
+		file.Data = data
+	}
+	return file, nil
+}
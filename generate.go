@@ -0,0 +1,108 @@
+package virt
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Generator generates Go source code that embeds a filesystem as a Tree or List
+// literal. Files are written in lexical order, so the output is deterministic.
+type Generator struct {
+	Package     string // Package name of the generated file
+	Name        string // Variable name of the filesystem
+	List        bool   // Generate a virt.List instead of a virt.Tree
+	SkipModTime bool   // Leave out modification times
+}
+
+// Generate gofmt-ed Go source code for the filesystem at subpath
+func (g *Generator) Generate(fsys fs.FS, subpaths ...string) ([]byte, error) {
+	if !token.IsIdentifier(g.Package) {
+		return nil, fmt.Errorf("virt: invalid package name %q", g.Package)
+	}
+	if !token.IsIdentifier(g.Name) {
+		return nil, fmt.Errorf("virt: invalid variable name %q", g.Name)
+	}
+	dir := path.Join(subpaths...)
+	if dir == "" {
+		dir = "."
+	}
+	list, err := fromFS(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	imports := map[string]bool{}
+	body := new(strings.Builder)
+	if g.List {
+		fmt.Fprintf(body, "var %s = virt.List{\n", g.Name)
+	} else {
+		fmt.Fprintf(body, "var %s = virt.Tree{\n", g.Name)
+	}
+	for _, file := range list {
+		fields := []string{}
+		if g.List {
+			fields = append(fields, "Path: "+strconv.Quote(file.Path))
+		}
+		if len(file.Data) > 0 {
+			fields = append(fields, `Data: []byte("`+file.Embed()+`")`)
+		}
+		if file.Mode != 0 {
+			fields = append(fields, "Mode: "+modeLiteral(file.Mode, imports))
+		}
+		if !g.SkipModTime && !file.ModTime.IsZero() {
+			imports["time"] = true
+			t := file.ModTime
+			fields = append(fields, fmt.Sprintf("ModTime: time.Unix(%d, %d)", t.Unix(), t.Nanosecond()))
+		}
+		literal := "&virt.File{" + strings.Join(fields, ", ") + "}"
+		if g.List {
+			fmt.Fprintf(body, "%s,\n", literal)
+		} else {
+			fmt.Fprintf(body, "%s: %s,\n", strconv.Quote(file.Path), literal)
+		}
+	}
+	body.WriteString("}\n")
+	code := new(strings.Builder)
+	code.WriteString("// Code generated by virt. DO NOT EDIT.\n\n")
+	fmt.Fprintf(code, "package %s\n\n", g.Package)
+	code.WriteString("import (\n")
+	if imports["io/fs"] {
+		code.WriteString("\t\"io/fs\"\n")
+	}
+	if imports["time"] {
+		code.WriteString("\t\"time\"\n")
+	}
+	code.WriteString("\n\t\"github.com/matthewmueller/virt\"\n)\n\n")
+	code.WriteString(body.String())
+	return format.Source([]byte(code.String()))
+}
+
+// modeLiteral returns the Go expression for a file mode
+func modeLiteral(mode fs.FileMode, imports map[string]bool) string {
+	var parts []string
+	types := []struct {
+		mode fs.FileMode
+		name string
+	}{
+		{fs.ModeDir, "fs.ModeDir"},
+		{fs.ModeSymlink, "fs.ModeSymlink"},
+	}
+	for _, t := range types {
+		if mode&t.mode != 0 {
+			parts = append(parts, t.name)
+			mode &^= t.mode
+		}
+	}
+	if len(parts) > 0 {
+		imports["io/fs"] = true
+	}
+	// Any other mode bits are written numerically
+	if mode != 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%#o", uint32(mode)))
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,75 @@
+package virt_test
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestGenerateTree(t *testing.T) {
+	is := is.New(t)
+	modTime := time.Date(2021, 8, 4, 14, 56, 0, 5, time.UTC)
+	tree := virt.Tree{
+		"b.txt":    &virt.File{Data: []byte("b"), Mode: 0644, ModTime: modTime},
+		"a/a.txt":  &virt.File{Data: []byte("a\n"), Mode: 0600},
+		"link.txt": &virt.File{Data: []byte("b.txt"), Mode: 0777 | fs.ModeSymlink},
+	}
+	generator := &virt.Generator{Package: "templates", Name: "FS"}
+	code, err := generator.Generate(tree)
+	is.NoErr(err)
+	is.Equal(string(code), `// Code generated by virt. DO NOT EDIT.
+
+package templates
+
+import (
+	"io/fs"
+	"time"
+
+	"github.com/matthewmueller/virt"
+)
+
+var FS = virt.Tree{
+	"a":        &virt.File{Mode: fs.ModeDir},
+	"a/a.txt":  &virt.File{Data: []byte("\x61\x0a"), Mode: 0600},
+	"b.txt":    &virt.File{Data: []byte("\x62"), Mode: 0644, ModTime: time.Unix(1628088960, 5)},
+	"link.txt": &virt.File{Data: []byte("\x62\x2e\x74\x78\x74"), Mode: fs.ModeSymlink | 0777},
+}
+`)
+	// Output is deterministic
+	again, err := generator.Generate(tree)
+	is.NoErr(err)
+	is.Equal(string(again), string(code))
+}
+
+func TestGenerateList(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"b.txt": &virt.File{Data: []byte("b"), Mode: 0644, ModTime: time.Unix(1628088960, 0)},
+	}
+	generator := &virt.Generator{Package: "templates", Name: "files", List: true, SkipModTime: true}
+	code, err := generator.Generate(tree)
+	is.NoErr(err)
+	is.Equal(string(code), `// Code generated by virt. DO NOT EDIT.
+
+package templates
+
+import (
+	"github.com/matthewmueller/virt"
+)
+
+var files = virt.List{
+	&virt.File{Path: "b.txt", Data: []byte("\x62"), Mode: 0644},
+}
+`)
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	is := is.New(t)
+	_, err := (&virt.Generator{Package: "my-package", Name: "FS"}).Generate(virt.Tree{})
+	is.True(err != nil)
+	_, err = (&virt.Generator{Package: "templates", Name: ""}).Generate(virt.Tree{})
+	is.True(err != nil)
+}
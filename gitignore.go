@@ -0,0 +1,231 @@
+package virt
+
+import (
+	"bufio"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Gitignore returns a matcher that follows .gitignore rules. Patterns are
+// compiled as if they were in a .gitignore at the root of fsys, followed by
+// any .gitignore files found in fsys. Nested .gitignore files are loaded as
+// directories are matched and apply to paths within their directory.
+func Gitignore(fsys fs.FS, patterns ...string) Matcher {
+	g := &gitignore{
+		fsys:  fsys,
+		extra: compileGitignore(".", strings.Join(patterns, "\n")),
+		dirs:  map[string][]*gitignorePattern{},
+	}
+	return g.Match
+}
+
+type gitignore struct {
+	fsys  fs.FS
+	extra []*gitignorePattern
+
+	mu   sync.Mutex
+	dirs map[string][]*gitignorePattern
+}
+
+// Match returns true if the path is ignored. A path is also ignored when any of
+// its parent directories are ignored.
+func (g *gitignore) Match(fpath string) bool {
+	if fpath == "." || !fs.ValidPath(fpath) {
+		return false
+	}
+	elements := strings.Split(fpath, "/")
+	for i := range elements {
+		subpath := strings.Join(elements[:i+1], "/")
+		isDir := i < len(elements)-1
+		if !isDir {
+			if info, err := fs.Stat(g.fsys, subpath); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if g.ignored(subpath, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored checks the path against the patterns that apply to it. The last
+// matching pattern wins and deeper .gitignore files override shallower ones.
+func (g *gitignore) ignored(fpath string, isDir bool) (ignored bool) {
+	for _, pattern := range g.extra {
+		if pattern.Match(fpath, isDir) {
+			ignored = !pattern.negate
+		}
+	}
+	dir := "."
+	elements := strings.Split(fpath, "/")
+	for i := 0; i < len(elements); i++ {
+		for _, pattern := range g.load(dir) {
+			if pattern.Match(fpath, isDir) {
+				ignored = !pattern.negate
+			}
+		}
+		dir = path.Join(dir, elements[i])
+	}
+	return ignored
+}
+
+// load the .gitignore patterns within dir, caching the results
+func (g *gitignore) load(dir string) []*gitignorePattern {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if patterns, ok := g.dirs[dir]; ok {
+		return patterns
+	}
+	// Missing or unreadable .gitignore files are treated as empty
+	data, err := fs.ReadFile(g.fsys, path.Join(dir, ".gitignore"))
+	if err != nil {
+		g.dirs[dir] = nil
+		return nil
+	}
+	patterns := compileGitignore(dir, string(data))
+	g.dirs[dir] = patterns
+	return patterns
+}
+
+type gitignorePattern struct {
+	dir     string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// Match the pattern against a path relative to the root
+func (p *gitignorePattern) Match(fpath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.dir != "." {
+		if !strings.HasPrefix(fpath, p.dir+"/") {
+			return false
+		}
+		fpath = fpath[len(p.dir)+1:]
+	}
+	return p.re.MatchString(fpath)
+}
+
+// compileGitignore compiles the lines of a .gitignore file located in dir.
+// Invalid patterns are skipped, just like git.
+func compileGitignore(dir, content string) (patterns []*gitignorePattern) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		pattern, ok := compileGitignoreLine(dir, scanner.Text())
+		if !ok {
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+func compileGitignoreLine(dir, line string) (*gitignorePattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless they're escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, false
+	}
+	pattern := &gitignorePattern{dir: dir}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return nil, false
+	}
+	// Patterns with a slash at the beginning or middle are anchored to the
+	// directory of the .gitignore file, otherwise they match at any depth.
+	if strings.HasPrefix(line, "/") {
+		line = line[1:]
+	} else if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	re, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return nil, false
+	}
+	pattern.re = re
+	return pattern, true
+}
+
+// globToRegexp converts a gitignore glob into a regular expression
+func globToRegexp(glob string) string {
+	segments := strings.Split(glob, "/")
+	re := new(strings.Builder)
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			if last {
+				// Trailing "/**" matches everything inside
+				re.WriteString(".*")
+			} else {
+				// Leading "**/" and inner "/**/" match zero or more directories
+				re.WriteString("(?:.*/)?")
+			}
+			continue
+		}
+		re.WriteString(segmentToRegexp(segment))
+		if !last {
+			re.WriteString("/")
+		}
+	}
+	return re.String()
+}
+
+func segmentToRegexp(segment string) string {
+	re := new(strings.Builder)
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch c {
+		case '*':
+			re.WriteString("[^/]*")
+		case '?':
+			re.WriteString("[^/]")
+		case '\\':
+			if i+1 < len(segment) {
+				i++
+				re.WriteString(regexp.QuoteMeta(string(segment[i])))
+			}
+		case '[':
+			end := strings.IndexByte(segment[i+1:], ']')
+			// Allow "]" as the first character in the class
+			if end == 0 || (end == 1 && (segment[i+1] == '!' || segment[i+1] == '^')) {
+				next := strings.IndexByte(segment[i+end+2:], ']')
+				if next < 0 {
+					end = -1
+				} else {
+					end += next + 1
+				}
+			}
+			if end < 0 {
+				re.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := segment[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return re.String()
+}
@@ -0,0 +1,113 @@
+package virt_test
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestGitignore(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.Tree{
+		".gitignore": &virt.File{Data: []byte(`
+# comments are skipped
+*.log
+!keep.log
+/build
+node_modules/
+docs/**/*.tmp
+\#hash
+`)},
+		"a.log":                 &virt.File{},
+		"keep.log":              &virt.File{},
+		"sub/b.log":             &virt.File{},
+		"sub/keep.log":          &virt.File{},
+		"build/out.js":          &virt.File{},
+		"sub/build/out.js":      &virt.File{},
+		"node_modules/x/x.js":   &virt.File{},
+		"sub/node_modules/y.js": &virt.File{},
+		"node_modules.txt":      &virt.File{},
+		"docs/a.tmp":            &virt.File{},
+		"docs/guide/deep/b.tmp": &virt.File{},
+		"docs/guide/c.md":       &virt.File{},
+		"#hash":                 &virt.File{},
+		"main.go":               &virt.File{},
+		"sub/.gitignore":        &virt.File{Data: []byte("*.go\n!keep.go\nlocal/\n")},
+		"sub/main.go":           &virt.File{},
+		"sub/keep.go":           &virt.File{},
+		"sub/local/local.txt":   &virt.File{},
+		"sub/other/local":       &virt.File{},
+	}
+	match := virt.Gitignore(fsys)
+	tests := map[string]bool{
+		".":                     false,
+		"a.log":                 true,
+		"keep.log":              false,
+		"sub/b.log":             true,
+		"sub/keep.log":          false,
+		"build":                 true,
+		"build/out.js":          true,
+		"sub/build/out.js":      false,
+		"node_modules":          true,
+		"node_modules/x/x.js":   true,
+		"sub/node_modules/y.js": true,
+		"node_modules.txt":      false,
+		"docs/a.tmp":            true,
+		"docs/guide/deep/b.tmp": true,
+		"docs/guide/c.md":       false,
+		"#hash":                 true,
+		"main.go":               false,
+		"sub/main.go":           true,
+		"sub/keep.go":           false,
+		"sub/local/local.txt":   true,
+		"sub/other/local":       false,
+	}
+	for path, expect := range tests {
+		if match(path) != expect {
+			t.Errorf("expected %q to match %v", path, expect)
+		}
+	}
+	is.True(match("new/file.log"))
+}
+
+func TestGitignorePatterns(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.Tree{
+		"a/b/c.txt":  &virt.File{},
+		"a/b/d.txt":  &virt.File{},
+		"x/a/b.txt":  &virt.File{},
+		"x/[ab].txt": &virt.File{},
+		"x/c.txt":    &virt.File{},
+	}
+	match := virt.Gitignore(fsys, "a/**", "x/[!c].txt", "?/b.txt")
+	is.True(match("a/b/c.txt"))
+	is.True(match("a/b"))
+	is.True(!match("a"))
+	is.True(match("x/a.txt"))
+	is.True(!match("x/c.txt"))
+	is.True(!match("x/a/b.txt"))
+	is.True(match("a/b.txt"))
+}
+
+func TestExcludeGitignore(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		".gitignore":     &virt.File{Data: []byte("bud/\n*.log\n")},
+		"view/a.txt":     &virt.File{Data: []byte("a")},
+		"view/debug.log": &virt.File{Data: []byte("log")},
+		"bud/bud.go":     &virt.File{Data: []byte("bud")},
+	}
+	fsys := virt.Exclude(tree, virt.Gitignore(tree))
+	paths := []string{}
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	is.NoErr(err)
+	is.Equal(paths, []string{".", ".gitignore", "view", "view/a.txt"})
+}
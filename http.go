@@ -0,0 +1,227 @@
+package virt
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Server serves a filesystem over HTTP. Files are served with an ETag and a
+// Last-Modified header, and support Range, If-None-Match and If-Modified-Since
+// requests.
+//
+// ETags are derived from File.Hash for the virtual filesystems. For other
+// filesystems, the contents are hashed and remembered until the file's size,
+// mode or modification time changes. Only the most recently served files are
+// remembered.
+type Server struct {
+	FS    fs.FS
+	Index bool // Serve index.html for directories
+	List  bool // List directories that aren't served by an index.html
+
+	mu    sync.Mutex
+	etags map[string]*list.Element // Elements hold a *serverETag
+	lru   *list.List               // Most recently used paths are in front
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// maxServerETags is the number of ETags a server remembers
+const maxServerETags = 1024
+
+// serverETag is a content hash along with the stamp of the file when it was
+// hashed
+type serverETag struct {
+	path  string
+	stamp string
+	etag  string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	upath := path.Clean("/" + r.URL.Path)
+	name := strings.TrimPrefix(upath, "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(s.FS, name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if !info.IsDir() {
+		s.serveFile(w, r, name)
+		return
+	}
+	// Redirect to the trailing slash, so relative links within the directory
+	// resolve correctly
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		location := "./"
+		if upath != "/" {
+			location = path.Base(upath) + "/"
+		}
+		redirect(w, r, location)
+		return
+	}
+	if s.Index {
+		index := path.Join(name, "index.html")
+		if info, err := fs.Stat(s.FS, index); err == nil && !info.IsDir() {
+			s.serveFile(w, r, index)
+			return
+		}
+	}
+	if !s.List {
+		serveError(w, fs.ErrNotExist)
+		return
+	}
+	s.serveList(w, r, name)
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	file, err := s.FS.Open(name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		// Buffer the file to support range requests
+		data, err := io.ReadAll(file)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	etag, err := s.etag(name, info, file, content)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+// etag returns the file's hash as a strong ETag
+func (s *Server) etag(name string, info fs.FileInfo, file fs.File, content io.ReadSeeker) (string, error) {
+	if file, ok := file.(interface{ Hash(hash.Hash) []byte }); ok {
+		return quoteETag(file.Hash(sha256.New())), nil
+	}
+	stamp := stampInfo(info.Size(), info.Mode(), info.ModTime())
+	if etag, ok := s.cachedETag(name, stamp); ok {
+		return etag, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := quoteETag(h.Sum(nil))
+	s.storeETag(name, stamp, etag)
+	return etag, nil
+}
+
+// cachedETag returns the remembered ETag if the file hasn't changed since it
+// was hashed
+func (s *Server) cachedETag(name, stamp string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.etags[name]
+	if !ok || elem.Value.(*serverETag).stamp != stamp {
+		return "", false
+	}
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*serverETag).etag, true
+}
+
+// storeETag remembers the ETag, forgetting the least recently used ETags when
+// there are too many
+func (s *Server) storeETag(name, stamp, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.etags == nil {
+		s.etags = map[string]*list.Element{}
+		s.lru = list.New()
+	}
+	if elem, ok := s.etags[name]; ok {
+		elem.Value = &serverETag{name, stamp, etag}
+		s.lru.MoveToFront(elem)
+		return
+	}
+	s.etags[name] = s.lru.PushFront(&serverETag{name, stamp, etag})
+	for s.lru.Len() > maxServerETags {
+		oldest := s.lru.Remove(s.lru.Back()).(*serverETag)
+		delete(s.etags, oldest.path)
+	}
+}
+
+func quoteETag(sum []byte) string {
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request, name string) {
+	des, err := fs.ReadDir(s.FS, name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString("<!doctype html>\n<meta charset=\"utf-8\">\n<pre>\n")
+	for _, de := range des {
+		entry := de.Name()
+		if de.IsDir() {
+			entry += "/"
+		}
+		href := url.URL{Path: entry}
+		buf.WriteString(`<a href="` + html.EscapeString(href.String()) + `">` + html.EscapeString(entry) + "</a>\n")
+	}
+	buf.WriteString("</pre>\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(buf.Bytes())
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, location string) {
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// serveError responds with the status code for the error
+func serveError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,152 @@
+package virt_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func serve(t testing.TB, handler http.Handler, method, target string, headers ...string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	res := rec.Result()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(body)
+}
+
+func TestServerFile(t *testing.T) {
+	is := is.New(t)
+	modTime := time.Date(2021, 8, 4, 14, 56, 0, 0, time.UTC)
+	server := &virt.Server{FS: virt.Tree{
+		"a.txt": &virt.File{Data: []byte("hello world"), Mode: 0644, ModTime: modTime},
+	}}
+	res, body := serve(t, server, "GET", "/a.txt")
+	is.Equal(res.StatusCode, 200)
+	is.Equal(body, "hello world")
+	is.Equal(res.Header.Get("Content-Type"), "text/plain; charset=utf-8")
+	is.Equal(res.Header.Get("Last-Modified"), "Wed, 04 Aug 2021 14:56:00 GMT")
+	etag := res.Header.Get("ETag")
+	is.True(len(etag) > 2)
+	// Conditional requests
+	res, body = serve(t, server, "GET", "/a.txt", "If-None-Match", etag)
+	is.Equal(res.StatusCode, 304)
+	is.Equal(body, "")
+	res, _ = serve(t, server, "GET", "/a.txt", "If-Modified-Since", "Wed, 04 Aug 2021 14:56:00 GMT")
+	is.Equal(res.StatusCode, 304)
+	res, _ = serve(t, server, "GET", "/a.txt", "If-Modified-Since", "Wed, 04 Aug 2021 14:55:00 GMT")
+	is.Equal(res.StatusCode, 200)
+	// Range requests
+	res, body = serve(t, server, "GET", "/a.txt", "Range", "bytes=6-")
+	is.Equal(res.StatusCode, 206)
+	is.Equal(body, "world")
+	is.Equal(res.Header.Get("Content-Range"), "bytes 6-10/11")
+	// HEAD requests
+	res, body = serve(t, server, "HEAD", "/a.txt")
+	is.Equal(res.StatusCode, 200)
+	is.Equal(body, "")
+	// Other methods
+	res, _ = serve(t, server, "POST", "/a.txt")
+	is.Equal(res.StatusCode, 405)
+	// Missing files
+	res, _ = serve(t, server, "GET", "/b.txt")
+	is.Equal(res.StatusCode, 404)
+}
+
+func TestServerETagChanges(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"a.txt": &virt.File{Data: []byte("a"), Mode: 0644},
+	}
+	server := &virt.Server{FS: tree}
+	res, _ := serve(t, server, "GET", "/a.txt")
+	before := res.Header.Get("ETag")
+	tree["a.txt"] = &virt.File{Data: []byte("b"), Mode: 0644}
+	res, body := serve(t, server, "GET", "/a.txt", "If-None-Match", before)
+	is.Equal(res.StatusCode, 200)
+	is.Equal(body, "b")
+	is.True(res.Header.Get("ETag") != before)
+}
+
+func TestServerOS(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	server := &virt.Server{FS: virt.OS(dir)}
+	res, body := serve(t, server, "GET", "/a.txt")
+	is.Equal(res.StatusCode, 200)
+	is.Equal(body, "a")
+	etag := res.Header.Get("ETag")
+	is.True(etag != "")
+	res, _ = serve(t, server, "GET", "/a.txt", "If-None-Match", etag)
+	is.Equal(res.StatusCode, 304)
+	// The hash is recomputed when the file changes
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("bb"), 0644))
+	res, body = serve(t, server, "GET", "/a.txt", "If-None-Match", etag)
+	is.Equal(res.StatusCode, 200)
+	is.Equal(body, "bb")
+	is.True(res.Header.Get("ETag") != etag)
+}
+
+func TestServerDirectory(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.Tree{
+		"index.html":     &virt.File{Data: []byte("<h1>home</h1>"), Mode: 0644},
+		"docs/a.txt":     &virt.File{Data: []byte("a"), Mode: 0644},
+		"docs/b c.txt":   &virt.File{Data: []byte("b"), Mode: 0644},
+		"docs/sub/c.txt": &virt.File{Data: []byte("c"), Mode: 0644},
+	}
+	// Directories aren't served by default
+	server := &virt.Server{FS: fsys}
+	res, _ := serve(t, server, "GET", "/")
+	is.Equal(res.StatusCode, 404)
+	res, _ = serve(t, server, "GET", "/docs/")
+	is.Equal(res.StatusCode, 404)
+	// Index pages
+	server = &virt.Server{FS: fsys, Index: true}
+	res, body := serve(t, server, "GET", "/")
+	is.Equal(res.StatusCode, 200)
+	is.Equal(body, "<h1>home</h1>")
+	is.Equal(res.Header.Get("Content-Type"), "text/html; charset=utf-8")
+	// Listings
+	server = &virt.Server{FS: fsys, Index: true, List: true}
+	res, _ = serve(t, server, "GET", "/docs")
+	is.Equal(res.StatusCode, 301)
+	is.Equal(res.Header.Get("Location"), "docs/")
+	res, body = serve(t, server, "GET", "/docs/")
+	is.Equal(res.StatusCode, 200)
+	is.Equal(body, "<!doctype html>\n<meta charset=\"utf-8\">\n<pre>\n"+
+		"<a href=\"a.txt\">a.txt</a>\n"+
+		"<a href=\"b%20c.txt\">b c.txt</a>\n"+
+		"<a href=\"sub/\">sub/</a>\n"+
+		"</pre>\n")
+}
+
+func TestServerRootRedirect(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.Tree{
+		"a.txt": &virt.File{Data: []byte("a"), Mode: 0644},
+	}
+	server := &virt.Server{FS: fsys, List: true}
+	// Handlers mounted with http.StripPrefix see an empty path for the root
+	req := httptest.NewRequest("GET", "/", nil)
+	req.URL.Path = ""
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	is.Equal(rec.Code, 301)
+	is.Equal(rec.Header().Get("Location"), "./")
+}
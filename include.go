@@ -0,0 +1,93 @@
+package virt
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+// Include only the files that match. Directories are kept when they contain
+// a matching file, so the matching files can still be reached. Empty
+// directories are left out.
+func Include(fsys fs.FS, fn Matcher) fs.FS {
+	return &exclude{
+		FS: fsys,
+		fn: func(path string) bool {
+			return !included(fsys, fn, path)
+		},
+		entries: func(dir string) Matcher {
+			kept := includedEntries(fsys, fn, dir)
+			return func(path string) bool {
+				return !kept[path]
+			}
+		},
+	}
+}
+
+// included returns true if the path is a matching file or a directory that
+// contains a matching file.
+func included(fsys fs.FS, fn Matcher, name string) bool {
+	if name == "." {
+		return true
+	}
+	info, err := lstat(fsys, name)
+	if err != nil {
+		return false
+	} else if !info.IsDir() {
+		return fn(name)
+	}
+	found := false
+	err = fs.WalkDir(fsys, name, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip over directories we can't read
+			if ignoreError(err) {
+				return nil
+			}
+			return err
+		} else if de.IsDir() {
+			return nil
+		} else if fn(path) {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.SkipAll) {
+		return false
+	}
+	return found
+}
+
+// includedEntries returns the paths of the entries within dir that are
+// included. The directory is walked once, rather than once for each entry.
+func includedEntries(fsys fs.FS, fn Matcher, dir string) map[string]bool {
+	kept := map[string]bool{}
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	fs.WalkDir(fsys, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip over directories we can't read
+			if ignoreError(err) {
+				return nil
+			}
+			return err
+		} else if path == dir {
+			return nil
+		}
+		entry, _, _ := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+		if de.IsDir() {
+			// Skip the rest of entries that are already kept
+			if kept[prefix+entry] {
+				return fs.SkipDir
+			}
+			return nil
+		} else if fn(path) {
+			// Keep the entry within dir that leads to the matching file
+			kept[prefix+entry] = true
+		}
+		return nil
+	})
+	return kept
+}
@@ -0,0 +1,38 @@
+package virt_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestInclude(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"cmd/app/main.go":   &virt.File{Data: []byte("package main")},
+		"cmd/app/README.md": &virt.File{Data: []byte("# app")},
+		"cmd/tool/tool.go":  &virt.File{Data: []byte("package main")},
+		"cmd/docs/doc.md":   &virt.File{Data: []byte("# doc")},
+		"internal/x.go":     &virt.File{Data: []byte("package internal")},
+		"go.mod":            &virt.File{Data: []byte("module app")},
+	}
+	fsys := virt.Include(tree, virt.And(virt.Within("cmd"), virt.Ext(".go")))
+	actual, err := virt.Print(fsys)
+	is.NoErr(err)
+	is.Equal(actual, `.
+└── cmd
+    ├── app
+    │   └── main.go
+    └── tool
+        └── tool.go
+`)
+	_, err = fs.Stat(fsys, "cmd/docs")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	_, err = fs.ReadFile(fsys, "internal/x.go")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	is.NoErr(fstest.TestFS(fsys, "cmd/app/main.go", "cmd/tool/tool.go"))
+}
@@ -0,0 +1,195 @@
+package virt
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// fileJSON is the wire format for a file. Data is base64-encoded and symlink
+// targets are stored in Link rather than Data.
+type fileJSON struct {
+	Path    string          `json:"path"`
+	Mode    fs.FileMode     `json:"mode"`
+	ModTime *time.Time      `json:"modTime,omitempty"`
+	Data    []byte          `json:"data,omitempty"`
+	Link    string          `json:"link,omitempty"`
+	Entries []*dirEntryJSON `json:"entries,omitempty"`
+}
+
+type dirEntryJSON struct {
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime *time.Time  `json:"modTime,omitempty"`
+}
+
+var _ json.Marshaler = (*File)(nil)
+var _ json.Unmarshaler = (*File)(nil)
+var _ json.Marshaler = (Tree)(nil)
+var _ json.Unmarshaler = (*Tree)(nil)
+var _ json.Marshaler = (List)(nil)
+var _ json.Unmarshaler = (*List)(nil)
+
+// MarshalJSON encodes the file as JSON
+func (f *File) MarshalJSON() ([]byte, error) {
+	return json.Marshal(toFileJSON(f.Path, f))
+}
+
+// UnmarshalJSON decodes the file from JSON
+func (f *File) UnmarshalJSON(data []byte) error {
+	var fj fileJSON
+	if err := json.Unmarshal(data, &fj); err != nil {
+		return err
+	}
+	*f = *fromFileJSON(&fj)
+	return nil
+}
+
+// MarshalJSON encodes the tree as a JSON array of files sorted by path.
+// Directory entries are left out since they're synthesized when read.
+func (t Tree) MarshalJSON() ([]byte, error) {
+	files := make([]*fileJSON, 0, len(t))
+	for fpath, file := range t {
+		fj := toFileJSON(fpath, file)
+		fj.Entries = nil
+		files = append(files, fj)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return json.Marshal(files)
+}
+
+// UnmarshalJSON decodes a JSON array of files into the tree, replacing any
+// files that were already in it
+func (t *Tree) UnmarshalJSON(data []byte) error {
+	var files []*fileJSON
+	if err := json.Unmarshal(data, &files); err != nil {
+		return err
+	}
+	for _, fj := range files {
+		if !fs.ValidPath(fj.Path) {
+			return &fs.PathError{Op: "UnmarshalJSON", Path: fj.Path, Err: fs.ErrInvalid}
+		}
+	}
+	if *t == nil {
+		*t = Tree{}
+	}
+	clear(*t)
+	for _, fj := range files {
+		(*t)[fj.Path] = fromFileJSON(fj)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the list as a JSON array of files. Directory entries are
+// left out since they're synthesized when read.
+func (l List) MarshalJSON() ([]byte, error) {
+	files := make([]*fileJSON, len(l))
+	for i, file := range l {
+		files[i] = toFileJSON(file.Path, file)
+		files[i].Entries = nil
+	}
+	return json.Marshal(files)
+}
+
+// UnmarshalJSON decodes a JSON array of files into the list
+func (l *List) UnmarshalJSON(data []byte) error {
+	var files []*fileJSON
+	if err := json.Unmarshal(data, &files); err != nil {
+		return err
+	}
+	list := make(List, 0, len(files))
+	for _, fj := range files {
+		if !fs.ValidPath(fj.Path) {
+			return &fs.PathError{Op: "UnmarshalJSON", Path: fj.Path, Err: fs.ErrInvalid}
+		}
+		list = append(list, fromFileJSON(fj))
+	}
+	*l = list
+	return nil
+}
+
+// MarshalJSON encodes the filesystem at subpath as a JSON array of files. The
+// document can be loaded back into a Tree with UnmarshalJSON.
+func MarshalJSON(fsys fs.FS, subpaths ...string) ([]byte, error) {
+	dir := path.Join(subpaths...)
+	if dir == "" {
+		dir = "."
+	}
+	list, err := fromFS(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return list.MarshalJSON()
+}
+
+// UnmarshalJSON decodes a JSON document created by MarshalJSON into a Tree
+func UnmarshalJSON(data []byte) (Tree, error) {
+	tree := Tree{}
+	if err := tree.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func toFileJSON(fpath string, f *File) *fileJSON {
+	fj := &fileJSON{
+		Path:    fpath,
+		Mode:    f.Mode,
+		ModTime: toTimeJSON(f.ModTime),
+	}
+	if f.Mode&fs.ModeSymlink != 0 {
+		fj.Link = string(f.Data)
+	} else {
+		fj.Data = f.Data
+	}
+	for _, de := range f.Entries {
+		fj.Entries = append(fj.Entries, &dirEntryJSON{
+			Path:    de.Path,
+			Size:    de.Size,
+			Mode:    de.Mode,
+			ModTime: toTimeJSON(de.ModTime),
+		})
+	}
+	return fj
+}
+
+func fromFileJSON(fj *fileJSON) *File {
+	file := &File{
+		Path:    fj.Path,
+		Data:    fj.Data,
+		Mode:    fj.Mode,
+		ModTime: fromTimeJSON(fj.ModTime),
+	}
+	if fj.Mode&fs.ModeSymlink != 0 {
+		file.Data = []byte(fj.Link)
+	}
+	for _, de := range fj.Entries {
+		file.Entries = append(file.Entries, &DirEntry{
+			Path:    de.Path,
+			Size:    de.Size,
+			Mode:    de.Mode,
+			ModTime: fromTimeJSON(de.ModTime),
+		})
+	}
+	return file
+}
+
+// Zero times are left out of the JSON
+func toTimeJSON(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func fromTimeJSON(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
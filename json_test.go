@@ -0,0 +1,128 @@
+package virt_test
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestFileJSON(t *testing.T) {
+	is := is.New(t)
+	modTime := time.Date(2021, 8, 4, 14, 56, 0, 0, time.UTC)
+	file := &virt.File{
+		Path:    "a.bin",
+		Data:    []byte{0, 1, 2, 255},
+		Mode:    0600,
+		ModTime: modTime,
+	}
+	data, err := json.Marshal(file)
+	is.NoErr(err)
+	is.Equal(string(data), `{"path":"a.bin","mode":384,"modTime":"2021-08-04T14:56:00Z","data":"AAEC/w=="}`)
+	var actual virt.File
+	is.NoErr(json.Unmarshal(data, &actual))
+	is.Equal(actual.Path, "a.bin")
+	is.Equal(actual.Data, []byte{0, 1, 2, 255})
+	is.Equal(actual.Mode, fs.FileMode(0600))
+	is.True(actual.ModTime.Equal(modTime))
+}
+
+func TestTreeJSON(t *testing.T) {
+	is := is.New(t)
+	modTime := time.Date(2021, 8, 4, 14, 56, 0, 0, time.UTC)
+	tree := virt.Tree{
+		"b.txt":    &virt.File{Data: []byte("b"), Mode: 0644, ModTime: modTime},
+		"a/a.txt":  &virt.File{Data: []byte("a"), Mode: 0644},
+		"a":        &virt.File{Mode: 0755 | fs.ModeDir},
+		"link.txt": &virt.File{Data: []byte("b.txt"), Mode: 0777 | fs.ModeSymlink},
+	}
+	data, err := json.Marshal(tree)
+	is.NoErr(err)
+	is.Equal(string(data), `[{"path":"a","mode":2147484141},{"path":"a/a.txt","mode":420,"data":"YQ=="},{"path":"b.txt","mode":420,"modTime":"2021-08-04T14:56:00Z","data":"Yg=="},{"path":"link.txt","mode":134218239,"link":"b.txt"}]`)
+	var actual virt.Tree
+	is.NoErr(json.Unmarshal(data, &actual))
+	is.Equal(len(actual), 4)
+	is.Equal(string(actual["a/a.txt"].Data), "a")
+	is.True(actual["a"].IsDir())
+	is.True(actual["b.txt"].ModTime.Equal(modTime))
+	link, err := actual.Readlink("link.txt")
+	is.NoErr(err)
+	is.Equal(link, "b.txt")
+
+	var list virt.List
+	is.NoErr(json.Unmarshal(data, &list))
+	is.Equal(len(list), 4)
+	is.Equal(list[0].Path, "a")
+	is.Equal(list[3].Path, "link.txt")
+	listData, err := json.Marshal(list)
+	is.NoErr(err)
+	is.Equal(string(listData), string(data))
+}
+
+func TestTreeJSONInvalidPath(t *testing.T) {
+	is := is.New(t)
+	var tree virt.Tree
+	err := json.Unmarshal([]byte(`[{"path":"../a.txt","mode":420}]`), &tree)
+	is.True(err != nil)
+}
+
+func TestTreeJSONReplace(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"old.txt": &virt.File{Data: []byte("old")},
+		"a.txt":   &virt.File{Data: []byte("old a")},
+	}
+	is.NoErr(json.Unmarshal([]byte(`[{"path":"a.txt","mode":420,"data":"YQ=="}]`), &tree))
+	is.Equal(len(tree), 1)
+	is.Equal(string(tree["a.txt"].Data), "a")
+	// Invalid paths leave the tree alone
+	err := json.Unmarshal([]byte(`[{"path":"b.txt","mode":420},{"path":"../c.txt","mode":420}]`), &tree)
+	is.True(err != nil)
+	is.Equal(len(tree), 1)
+	is.Equal(string(tree["a.txt"].Data), "a")
+}
+
+func TestMarshalJSONFS(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0600))
+	is.NoErr(os.Symlink("a.txt", filepath.Join(dir, "sub", "link.txt")))
+	data, err := virt.MarshalJSON(virt.OS(dir))
+	is.NoErr(err)
+	tree, err := virt.UnmarshalJSON(data)
+	is.NoErr(err)
+	is.Equal(len(tree), 3)
+	is.True(tree["sub"].IsDir())
+	is.Equal(string(tree["sub/a.txt"].Data), "a")
+	is.Equal(tree["sub/a.txt"].Mode, fs.FileMode(0600))
+	is.True(!tree["sub/a.txt"].ModTime.IsZero())
+	is.Equal(tree["sub/link.txt"].Mode&fs.ModeSymlink, fs.ModeSymlink)
+	is.Equal(string(tree["sub/link.txt"].Data), "a.txt")
+
+	// Marshal a subpath
+	data, err = virt.MarshalJSON(virt.OS(dir), "sub")
+	is.NoErr(err)
+	tree, err = virt.UnmarshalJSON(data)
+	is.NoErr(err)
+	is.Equal(len(tree), 3)
+}
+
+func TestTreeJSONAfterRead(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"a":       &virt.File{Mode: 0755 | fs.ModeDir},
+		"a/b.txt": &virt.File{Data: []byte("b"), Mode: 0644},
+	}
+	des, err := fs.ReadDir(tree, "a")
+	is.NoErr(err)
+	is.Equal(len(des), 1)
+	data, err := json.Marshal(tree)
+	is.NoErr(err)
+	is.Equal(string(data), `[{"path":"a","mode":2147484141},{"path":"a/b.txt","mode":420,"data":"Yg=="}]`)
+}
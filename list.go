@@ -1,7 +1,6 @@
 package virt
 
 import (
-	"errors"
 	"io/fs"
 	"os"
 	"sort"
@@ -9,134 +8,145 @@ import (
 	"time"
 )
 
-// List is meant to be a simple list of files. It's not a tree of files
-// and you can't walk it. Use Tree if you need a more capable filesystem.
+// List is meant to be a simple list of files. Directories are synthesized from
+// the paths of the files within them, like Tree. Use Tree if you need a more
+// capable filesystem.
 // This filesytem is not safe for concurrent use.
 type List []*File
 
 var _ FS = (*List)(nil)
 
 func (fsys List) Open(path string) (fs.File, error) {
-	return fsys.OpenFile(path, os.O_RDONLY, 0)
+	file, err := fsys.open("open", path, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
 }
 
 func (fsys List) Stat(path string) (fs.FileInfo, error) {
 	if !fs.ValidPath(path) {
-		return nil, &fs.PathError{Op: "Stat", Path: path, Err: fs.ErrInvalid}
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrInvalid}
 	}
-	file, ok := fsys.find(path)
-	if !ok {
-		return nil, fs.ErrNotExist
+	// If the file is a symlink, we need to resolve it.
+	target, err := followSymlinks("stat", path, fsys.find)
+	if err != nil {
+		return nil, err
 	}
-	if file.Mode&fs.ModeSymlink != 0 {
-		link, err := fsys.Stat(string(file.Data))
-		if err != nil {
-			return nil, &fs.PathError{Op: "Stat", Path: path, Err: err}
+	file, ok := fsys.find(target)
+	if !ok {
+		if file, err = fsys.dir("stat", target, nil); err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
 		}
-		// Stat returns the original name, but size, mode, and modTime of the target
-		return &fileInfo{
-			path:    path,
-			size:    link.Size(),
-			mode:    link.Mode(),
-			modTime: link.ModTime(),
-		}, nil
 	}
-	// If the file is a symlink, we need to resolve it.
-	return file.Info()
+	if target == path {
+		return file.Info()
+	}
+	// Stat returns the original name, but size, mode, and modTime of the target
+	return &fileInfo{
+		path:    path,
+		size:    int64(len(file.Data)),
+		mode:    file.Mode,
+		modTime: file.ModTime,
+	}, nil
 }
 
 func (fsys List) Lstat(path string) (fs.FileInfo, error) {
 	if !fs.ValidPath(path) {
-		return nil, &fs.PathError{Op: "Stat", Path: path, Err: fs.ErrInvalid}
+		return nil, &fs.PathError{Op: "lstat", Path: path, Err: fs.ErrInvalid}
 	}
 	file, ok := fsys.find(path)
 	if !ok {
-		return nil, fs.ErrNotExist
+		dir, err := fsys.dir("lstat", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		return dir.Info()
 	}
 	return file.Info()
 }
 
 func (fsys List) Readlink(path string) (string, error) {
 	if !fs.ValidPath(path) {
-		return "", &fs.PathError{Op: "Readlink", Path: path, Err: fs.ErrInvalid}
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
 	}
 	file, ok := fsys.find(path)
 	if !ok {
-		return "", fs.ErrNotExist
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrNotExist}
 	}
 	if file.Mode&fs.ModeSymlink == 0 {
-		return "", &fs.PathError{Op: "Readlink", Path: path, Err: fs.ErrInvalid}
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
 	}
 	return string(file.Data), nil
 }
 
+// OpenFile opens a file with the given flags. O_EXCL, O_TRUNC and O_APPEND are
+// supported. Symlinks are followed. Since a List value can't grow, OpenFile
+// can't create files, so O_CREATE fails with fs.ErrNotExist for files that
+// don't exist yet. Use WriteFile to create them.
 func (fsys List) OpenFile(path string, flag int, perm fs.FileMode) (RWFile, error) {
+	file, err := fsys.open("open", path, flag)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (fsys List) open(op, path string, flag int) (*openFile, error) {
 	if !fs.ValidPath(path) {
-		return nil, &fs.PathError{Op: "openfile", Path: path, Err: fs.ErrInvalid}
-	} else if flag != os.O_RDONLY {
-		return nil, &fs.PathError{
-			Op:   "openfile",
-			Path: path,
-			Err:  errors.New("flag not currently supported"),
-		}
+		return nil, &fs.PathError{Op: op, Path: path, Err: fs.ErrInvalid}
 	}
-	file, ok := fsys.find(path)
-	if !ok {
-		return nil, fs.ErrNotExist
+	target, err := followSymlinks(op, path, fsys.find)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := fsys.find(target)
+	if ok && !file.IsDir() {
+		return openTarget(op, path, file, flag)
 	}
-	// Found a file or directory
-	file.Path = path
-	if !file.IsDir() {
-		return &openFile{file, flag, 0}, nil
+	dir, err := fsys.dir(op, target, file)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
 	}
+	return openTarget(op, path, dir, flag)
+}
+
+// dir returns the directory with its entries. Directories are synthesized from
+// the paths of the files within them, so they don't need to be in the list.
+func (fsys List) dir(op, path string, file *File) (*File, error) {
 	// The following logic is based on "testing/fstest".MapFS.Open
 	// Directory, possibly synthesized.
-	// Note that file can be nil here: the map need not contain explicit parent directories for all its files.
+	// Note that file can be nil here: the list need not contain explicit parent directories for all its files.
 	// But file can also be non-nil, in case the user wants to set metadata for the directory explicitly.
 	// Either way, we need to construct the list of children of this directory.
 	var des []*DirEntry
 	var need = make(map[string]bool)
+	prefix := path + "/"
 	if path == "." {
-		for _, file := range fsys {
-			fname := file.Path
-			i := strings.Index(fname, "/")
-			if i < 0 {
-				if fname != "." {
-					file.Path = fname
-					des = append(des, file.Entry())
-				}
-			} else {
-				need[fname[:i]] = true
-			}
-		}
-	} else {
-		prefix := path + "/"
-		for _, file := range fsys {
-			fname := file.Path
-			if strings.HasPrefix(fname, prefix) {
-				felem := fname[len(prefix):]
-				i := strings.Index(felem, "/")
-				if i < 0 {
-					file.Path = felem
-					des = append(des, file.Entry())
-				} else {
-					need[fname[len(prefix):len(prefix)+i]] = true
-				}
-			}
+		prefix = ""
+	}
+	for _, file := range fsys {
+		if file.Path == "." || !strings.HasPrefix(file.Path, prefix) {
+			continue
 		}
-		// If the directory name is not in the map,
-		// and there are no children of the name in the map,
-		// then the directory is treated as not existing.
-		if file == nil && des == nil && len(need) == 0 {
-			return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+		felem := file.Path[len(prefix):]
+		if i := strings.Index(felem, "/"); i >= 0 {
+			need[felem[:i]] = true
+			continue
 		}
+		des = append(des, file.Entry())
+	}
+	// If the directory name is not in the list,
+	// and there are no children of the name in the list,
+	// then the directory is treated as not existing.
+	if path != "." && file == nil && des == nil && len(need) == 0 {
+		return nil, &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
 	}
 	for _, fi := range des {
 		delete(need, fi.Name())
 	}
-	for path := range need {
-		dir := &File{path, nil, fs.ModeDir, time.Time{}, nil}
-		des = append(des, dir.Entry())
+	for name := range need {
+		des = append(des, &DirEntry{Path: prefix + name, Mode: fs.ModeDir})
 	}
 	sort.Slice(des, func(i, j int) bool {
 		return des[i].Name() < des[j].Name()
@@ -147,31 +157,43 @@ func (fsys List) OpenFile(path string, flag int, perm fs.FileMode) (RWFile, erro
 	}
 	// Return the synthesized entries as a directory.
 	file.Entries = des
-	return &openFile{file, flag, 0}, nil
+	return file, nil
 }
 
-// Mkdir create a directory.
+// Mkdir create a directory and any parents that don't exist yet.
 func (fsys *List) MkdirAll(path string, perm fs.FileMode) error {
-	if path == "." {
+	if !fs.ValidPath(path) {
+		return &fs.PathError{Op: "MkdirAll", Path: path, Err: fs.ErrInvalid}
+	} else if path == "." {
 		return nil
 	}
-	file, ok := fsys.find(path)
-	if ok {
-		if file.IsDir() {
-			return nil
+	dir := ""
+	for _, element := range strings.Split(path, "/") {
+		dir = strings.TrimPrefix(dir+"/"+element, "/")
+		file, ok := fsys.find(dir)
+		if !ok {
+			*fsys = append(*fsys, &File{dir, nil, perm | fs.ModeDir, time.Time{}, nil})
+			continue
 		}
-		return &fs.PathError{
-			Op:   "MkdirAll",
-			Path: path,
-			Err:  fs.ErrExist,
+		if !file.IsDir() {
+			return &fs.PathError{
+				Op:   "MkdirAll",
+				Path: path,
+				Err:  errNotADirectory,
+			}
 		}
 	}
-	*fsys = append(*fsys, &File{path, nil, perm | fs.ModeDir, time.Time{}, nil})
 	return nil
 }
 
 // WriteFile writes a file
 func (fsys *List) WriteFile(path string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(path) {
+		return &fs.PathError{Op: "WriteFile", Path: path, Err: fs.ErrInvalid}
+	}
+	if err := checkParents("WriteFile", path, fsys.find); err != nil {
+		return err
+	}
 	file, ok := fsys.find(path)
 	if ok {
 		if file.IsDir() {
@@ -189,13 +211,20 @@ func (fsys *List) WriteFile(path string, data []byte, perm fs.FileMode) error {
 	return nil
 }
 
-// Remove removes a path
+// Remove removes a path and anything within it
 func (fsys *List) RemoveAll(path string) error {
-	idx := fsys.indexOf(path)
-	if idx < 0 {
-		return nil
+	if !fs.ValidPath(path) {
+		return &fs.PathError{Op: "RemoveAll", Path: path, Err: fs.ErrInvalid}
+	}
+	prefix := path + "/"
+	list := (*fsys)[:0]
+	for _, file := range *fsys {
+		if file.Path == path || strings.HasPrefix(file.Path, prefix) {
+			continue
+		}
+		list = append(list, file)
 	}
-	*fsys = append((*fsys)[:idx], (*fsys)[idx+1:]...)
+	*fsys = list
 	return nil
 }
 
@@ -207,12 +236,3 @@ func (l List) find(path string) (f *File, ok bool) {
 	}
 	return nil, false
 }
-
-func (l List) indexOf(path string) (i int) {
-	for i, file := range l {
-		if file.Path == path {
-			return i
-		}
-	}
-	return -1
-}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io/fs"
 	"testing"
+	"testing/fstest"
 
 	"github.com/matryer/is"
 	"github.com/matthewmueller/virt"
@@ -65,9 +66,10 @@ func TestListWriteRead(t *testing.T) {
 func TestListRoot(t *testing.T) {
 	is := is.New(t)
 	fsys := virt.List{}
+	// The root directory always exists
 	des, err := fs.ReadDir(fsys, ".")
-	is.True(errors.Is(err, fs.ErrNotExist))
-	is.Equal(des, nil)
+	is.NoErr(err)
+	is.Equal(len(des), 0)
 	fsys = virt.List{
 		&virt.File{
 			Path: ".",
@@ -125,10 +127,11 @@ func TestListEmptyPath(t *testing.T) {
 	is.True(err != nil)
 	is.True(errors.Is(err, fs.ErrInvalid))
 	is.Equal(code, nil)
+	// The root is a directory, which can't be read
 	code, err = fs.ReadFile(fsys, ".")
 	is.True(err != nil)
-	is.True(errors.Is(err, fs.ErrNotExist))
-	is.Equal(code, nil)
+	is.Equal(err.Error(), "read .: is a directory")
+	is.Equal(len(code), 0)
 }
 
 func TestListMkdirWriteChild(t *testing.T) {
@@ -238,3 +241,31 @@ func TestListSymlinkLstat(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(link, "to.txt")
 }
+
+func TestListTestFS(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.List{
+		&virt.File{Path: "a.txt", Data: []byte("a"), Mode: 0600},
+		&virt.File{Path: "bin", Mode: fs.ModeDir | 0700},
+		&virt.File{Path: "bin/run.sh", Data: []byte("#!/bin/sh"), Mode: 0755},
+		&virt.File{Path: "empty", Mode: fs.ModeDir | 0755},
+		&virt.File{Path: "nested/b/c.go", Data: []byte("package b")},
+	}
+	is.NoErr(fstest.TestFS(fsys, "a.txt", "bin/run.sh", "empty", "nested/b/c.go"))
+	// Opening directories doesn't change the paths in the list
+	is.Equal(fsys[2].Path, "bin/run.sh")
+	is.Equal(fsys[4].Path, "nested/b/c.go")
+}
+
+func TestListStatNotExist(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.List{}
+	_, err := fsys.Open("a.txt")
+	var pathErr *fs.PathError
+	is.True(errors.As(err, &pathErr))
+	is.Equal(pathErr.Path, "a.txt")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	_, err = fsys.Stat("a.txt")
+	is.True(errors.As(err, &pathErr))
+	is.True(errors.Is(err, fs.ErrNotExist))
+}
@@ -2,6 +2,10 @@ package virt
 
 import (
 	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Map is a simple in-memory filesystem.
@@ -21,20 +25,58 @@ func (m Map) Open(name string) (fs.File, error) {
 			Err:  fs.ErrInvalid,
 		}
 	}
-	return toTree(m).Open(name)
+	file, err := m.find("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &openFile{file, os.O_RDONLY, 0}, nil
 }
 
 func (m Map) Stat(name string) (fs.FileInfo, error) {
-	return toTree(m).Stat(name)
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := m.find("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return file.Info()
 }
 
-func toTree(m map[string]string) Tree {
-	tree := Tree{}
-	for path, data := range m {
-		tree[path] = &File{
-			Data: []byte(data),
-			Mode: fs.FileMode(0644),
+// find the file or synthesize the directory at name. Only the entries within
+// the directory are created, rather than the whole tree.
+func (m Map) find(op, name string) (*File, error) {
+	if data, ok := m[name]; ok {
+		return &File{name, []byte(data), 0644, time.Time{}, nil}, nil
+	}
+	var des []*DirEntry
+	var need = make(map[string]bool)
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	for fpath, data := range m {
+		if !strings.HasPrefix(fpath, prefix) {
+			continue
+		}
+		felem := fpath[len(prefix):]
+		if i := strings.Index(felem, "/"); i >= 0 {
+			need[felem[:i]] = true
+			continue
 		}
+		des = append(des, &DirEntry{Path: fpath, Size: int64(len(data)), Mode: 0644})
+	}
+	if name != "." && des == nil && len(need) == 0 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	for _, de := range des {
+		delete(need, de.Name())
+	}
+	for dir := range need {
+		des = append(des, &DirEntry{Path: prefix + dir, Mode: fs.ModeDir})
 	}
-	return tree
+	sort.Slice(des, func(i, j int) bool {
+		return des[i].Name() < des[j].Name()
+	})
+	return &File{name, nil, fs.ModeDir, time.Time{}, des}, nil
 }
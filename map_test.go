@@ -3,6 +3,7 @@ package virt_test
 import (
 	"io/fs"
 	"testing"
+	"testing/fstest"
 
 	"github.com/matryer/is"
 	"github.com/matthewmueller/virt"
@@ -40,3 +41,13 @@ func TestMap(t *testing.T) {
 	is.Equal(des[0].Name(), "controller")
 	is.Equal(des[1].Name(), "view")
 }
+
+func TestMapTestFS(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.Map{
+		"a.txt":         "a",
+		"bin/run.sh":    "#!/bin/sh",
+		"nested/b/c.go": "package b",
+	}
+	is.NoErr(fstest.TestFS(fsys, "a.txt", "bin/run.sh", "nested/b/c.go"))
+}
@@ -0,0 +1,93 @@
+package virt
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// And matches when all the matchers match
+func And(matchers ...Matcher) Matcher {
+	return func(path string) bool {
+		for _, match := range matchers {
+			if !match(path) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches when any of the matchers match
+func Or(matchers ...Matcher) Matcher {
+	return func(path string) bool {
+		for _, match := range matchers {
+			if match(path) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches when the matcher doesn't match
+func Not(match Matcher) Matcher {
+	return func(path string) bool {
+		return !match(path)
+	}
+}
+
+// Ext matches paths with any of the given extensions (e.g. ".go")
+func Ext(exts ...string) Matcher {
+	return func(fpath string) bool {
+		ext := path.Ext(fpath)
+		for _, e := range exts {
+			if ext == e {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Within matches the directory and every path within it
+func Within(dir string) Matcher {
+	return func(path string) bool {
+		return dir == "." || path == dir || strings.HasPrefix(path, dir+"/")
+	}
+}
+
+// Info matches paths whose file info satisfies fn. Symlinks are not followed
+// when the filesystem supports Lstat. Paths that can't be stat'd don't match.
+func Info(fsys fs.FS, fn func(info fs.FileInfo) bool) Matcher {
+	return func(path string) bool {
+		info, err := lstat(fsys, path)
+		if err != nil {
+			return false
+		}
+		return fn(info)
+	}
+}
+
+// MinSize matches files that are at least size bytes. Directories don't match.
+func MinSize(fsys fs.FS, size int64) Matcher {
+	return Info(fsys, func(info fs.FileInfo) bool {
+		return !info.IsDir() && info.Size() >= size
+	})
+}
+
+// MaxSize matches files that are at most size bytes. Directories don't match.
+func MaxSize(fsys fs.FS, size int64) Matcher {
+	return Info(fsys, func(info fs.FileInfo) bool {
+		return !info.IsDir() && info.Size() <= size
+	})
+}
+
+// Mode matches paths that have all of the given mode bits set. For example,
+// Mode(fsys, fs.ModeSymlink) matches symlinks and Mode(fsys, 0100) matches
+// files that are executable by their owner.
+func Mode(fsys fs.FS, mode fs.FileMode) Matcher {
+	return Info(fsys, func(info fs.FileInfo) bool {
+		return info.Mode()&mode == mode
+	})
+}
@@ -0,0 +1,46 @@
+package virt_test
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestMatchCombinators(t *testing.T) {
+	is := is.New(t)
+	goFiles := virt.Ext(".go")
+	is.True(goFiles("a/b.go"))
+	is.True(!goFiles("a/b.gox"))
+	is.True(virt.Or(virt.Ext(".md"), goFiles)("README.md"))
+	is.True(!virt.And(virt.Within("cmd"), goFiles)("internal/a.go"))
+	is.True(virt.And(virt.Within("cmd"), goFiles)("cmd/a.go"))
+	is.True(!virt.Within("cmd")("cmdx/a.go"))
+	is.True(virt.Within(".")("cmdx/a.go"))
+	is.True(virt.Not(goFiles)("a.txt"))
+	is.True(virt.And()("anything"))
+	is.True(!virt.Or()("anything"))
+}
+
+func TestMatchInfo(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"small.txt": &virt.File{Data: []byte("a"), Mode: 0644},
+		"large.txt": &virt.File{Data: []byte("aaaaaaaaaa"), Mode: 0644},
+		"run.sh":    &virt.File{Data: []byte("#!/bin/sh"), Mode: 0755},
+		"link.txt":  &virt.File{Data: []byte("small.txt"), Mode: 0777 | fs.ModeSymlink},
+		"dir":       &virt.File{Mode: 0755 | fs.ModeDir},
+	}
+	is.True(virt.MaxSize(tree, 5)("small.txt"))
+	is.True(!virt.MaxSize(tree, 5)("large.txt"))
+	is.True(!virt.MaxSize(tree, 5)("dir"))
+	is.True(!virt.MaxSize(tree, 5)("missing.txt"))
+	is.True(virt.MinSize(tree, 5)("large.txt"))
+	is.True(!virt.MinSize(tree, 5)("small.txt"))
+	is.True(virt.Mode(tree, 0100)("run.sh"))
+	is.True(!virt.Mode(tree, 0100)("small.txt"))
+	is.True(virt.Mode(tree, fs.ModeSymlink)("link.txt"))
+	is.True(virt.Mode(tree, fs.ModeDir)("dir"))
+	is.True(virt.Info(tree, func(info fs.FileInfo) bool { return info.Name() == "run.sh" })("run.sh"))
+}
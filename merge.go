@@ -186,11 +186,9 @@ func (d *mergeDir) Read(data []byte) (int, error) {
 }
 
 func (d *mergeDir) Close() error {
-	// Note: Do *not* clear the rest of the fields here, since the
-	// mergeDir also serves as a DirEntry or FileInfo, which must be
-	// able to outlive the File itself being closed.
-	d.entries = nil
-	d.readOffset = 0
+	// Note: Do *not* clear the entries here, since the mergeDir also serves as
+	// a DirEntry or FileInfo, which must be able to outlive the File itself
+	// being closed.
 	return nil
 }
 
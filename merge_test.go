@@ -145,3 +145,42 @@ func TestErrorPropagation(t *testing.T) {
 	}, "\n")
 	is.Equal(err.Error(), expect)
 }
+
+func TestMergeTestFS(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.Merge(
+		virt.Tree{
+			"a.txt":   &virt.File{Data: []byte("a"), Mode: 0644},
+			"d/b.txt": &virt.File{Data: []byte("b")},
+		},
+		virt.List{
+			&virt.File{Path: "d/c.txt", Data: []byte("c")},
+		},
+		virt.Map{"d/e/f.txt": "f"},
+		virt.Mount("nested/src", virt.Map{"g.txt": "g"}),
+	)
+	is.NoErr(fstest.TestFS(fsys, "a.txt", "d/b.txt", "d/c.txt", "d/e/f.txt", "nested/src/g.txt"))
+}
+
+func TestMergeReadDirAfterClose(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.Merge(
+		virt.Map{"d/a.txt": "a"},
+		virt.Map{"d/b.txt": "b"},
+	)
+	file, err := fsys.Open("d")
+	is.NoErr(err)
+	dir := file.(fs.ReadDirFile)
+	des, err := dir.ReadDir(1)
+	is.NoErr(err)
+	is.Equal(des[0].Name(), "a.txt")
+	is.NoErr(file.Close())
+	// The directory's info outlives the file, so closing keeps the entries
+	info, err := file.Stat()
+	is.NoErr(err)
+	is.True(info.IsDir())
+	des, err = dir.ReadDir(-1)
+	is.NoErr(err)
+	is.Equal(len(des), 1)
+	is.Equal(des[0].Name(), "b.txt")
+}
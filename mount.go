@@ -2,18 +2,20 @@ package virt
 
 import (
 	"io/fs"
+	"os"
+	"path"
 	"strings"
+	"time"
 )
 
+// Mount the filesystem at dir. The parent directories of dir are synthesized.
 func Mount(dir string, fsys fs.FS) fs.FS {
-	dirfs := Tree{dir: &File{Path: dir, Mode: fs.ModeDir}}
-	return &mountFS{dir, fsys, dirfs}
+	return &mountFS{dir, fsys}
 }
 
 type mountFS struct {
-	dir   string
-	fs    fs.FS
-	dirfs fs.FS
+	dir string
+	fs  fs.FS
 }
 
 func (m *mountFS) Open(name string) (fs.File, error) {
@@ -25,11 +27,62 @@ func (m *mountFS) Open(name string) (fs.File, error) {
 
 	// Lookup within the mounted filesystem.
 	if name == m.dir {
-		return m.fs.Open(".")
+		file, err := m.fs.Open(".")
+		if err != nil {
+			return nil, err
+		}
+		// Rename the root, so it matches the entry in its parent
+		return &mountDir{file, name}, nil
 	} else if strings.HasPrefix(name, prefix) {
 		return m.fs.Open(strings.TrimPrefix(name, prefix))
 	}
 
-	// Lookup within the generated filesystem.
-	return m.dirfs.Open(name)
+	// Lookup within the synthesized parent directories.
+	if name != "." && !strings.HasPrefix(m.dir, name+"/") {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	child := strings.TrimPrefix(m.dir, name+"/")
+	if name == "." {
+		child = m.dir
+	}
+	entry := &DirEntry{Path: path.Join(name, child), Mode: fs.ModeDir}
+	if i := strings.Index(child, "/"); i >= 0 {
+		entry.Path = path.Join(name, child[:i])
+	} else if info, err := fs.Stat(m.fs, "."); err == nil {
+		// The mount point itself has the mode of the mounted filesystem's root
+		entry.Mode = info.Mode()
+		entry.ModTime = info.ModTime()
+		entry.Size = info.Size()
+	}
+	dir := &File{name, nil, fs.ModeDir, time.Time{}, []*DirEntry{entry}}
+	return &openFile{dir, os.O_RDONLY, 0}, nil
+}
+
+// mountDir is the root of the mounted filesystem
+type mountDir struct {
+	fs.File
+	name string
+}
+
+var _ fs.ReadDirFile = (*mountDir)(nil)
+
+func (d *mountDir) Stat() (fs.FileInfo, error) {
+	info, err := d.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{
+		path:    d.name,
+		size:    info.Size(),
+		mode:    info.Mode(),
+		modTime: info.ModTime(),
+	}, nil
+}
+
+func (d *mountDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := d.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: errNotADirectory}
+	}
+	return dir.ReadDir(n)
 }
@@ -1,8 +1,12 @@
 package virt_test
 
 import (
+	"errors"
 	"io/fs"
+	"os"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	"github.com/matryer/is"
 	"github.com/matthewmueller/virt"
@@ -83,3 +87,22 @@ func TestMergeMount(t *testing.T) {
 	is.Equal(des[2].Name(), "nested")
 	is.Equal(des[2].IsDir(), true)
 }
+
+func TestMountTestFS(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	is.NoErr(os.MkdirAll(filepath.Join(dir, "b"), 0755))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "b", "b.txt"), []byte("b"), 0644))
+	fsys := virt.Mount("nested/src", virt.OS(dir))
+	is.NoErr(fstest.TestFS(fsys, "nested/src/a.txt", "nested/src/b/b.txt"))
+	// The mount point has the mode of the mounted directory
+	des, err := fs.ReadDir(fsys, "nested")
+	is.NoErr(err)
+	is.Equal(len(des), 1)
+	info, err := des[0].Info()
+	is.NoErr(err)
+	is.Equal(info.Mode(), fs.ModeDir|0755)
+	_, err = fs.Stat(fsys, "other")
+	is.True(errors.Is(err, fs.ErrNotExist))
+}
@@ -37,6 +37,14 @@ func (dir OS) Readlink(name string) (string, error) {
 	if !fs.ValidPath(name) {
 		return "", &fs.PathError{Op: "Readlink", Path: name, Err: fs.ErrInvalid}
 	}
+	// Match the virtual filesystems, which return fs.ErrInvalid for paths that
+	// aren't symlinks. The OS returns an error that's platform-specific.
+	info, err := dir.Lstat(name)
+	if err != nil {
+		return "", err
+	} else if info.Mode()&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "Readlink", Path: name, Err: fs.ErrInvalid}
+	}
 	return os.Readlink(filepath.Join(string(dir), name))
 }
 
@@ -1,47 +1,361 @@
 package virt
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"path"
-	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/xlab/treeprint"
 )
 
-// Print out a virtual filesystem.
+// Print out a virtual filesystem. When a subpath is given, it's printed beneath
+// the subpath's elements, so printing "a/b" shows "a", then "b", then the
+// contents of "a/b". Files can be printed too.
 func Print(fsys fs.FS, subpaths ...string) (string, error) {
+	printer := &Printer{}
+	return printer.Print(fsys, subpaths...)
+}
+
+// PrintFormat is the output format of a Printer
+type PrintFormat uint8
+
+const (
+	// PrintTree prints a tree, similar to the tree command
+	PrintTree PrintFormat = iota
+	// PrintJSON prints a nested JSON object for each directory
+	PrintJSON
+	// PrintJSONFlat prints a JSON array of entries sorted by path
+	PrintJSONFlat
+	// PrintFind prints one path per line sorted by path, similar to find
+	PrintFind
+	// PrintMarkdown prints a Markdown nested list
+	PrintMarkdown
+)
+
+// Printer prints out a virtual filesystem in a tree format with optional
+// details about each file, similar to the tree command.
+//
+// The tree format skips over paths that can't be read, like ls. The other
+// formats report permission and not-exist errors on the path that failed.
+type Printer struct {
+	Format   PrintFormat // Output format, defaults to PrintTree
+	Size     bool        // Show the size of each file
+	Mode     bool        // Show the permission bits of each file
+	ModTime  bool        // Show the modification time of each file
+	Link     bool        // Show symlink targets as "-> target"
+	Slash    bool        // Mark directories with a trailing slash
+	Depth    int         // Limit how deep to print, 0 means no limit
+	Collapse bool        // Collapse chains of single-child directories into one line
+}
+
+// Print out the filesystem at subpath
+func (p *Printer) Print(fsys fs.FS, subpaths ...string) (string, error) {
 	dir := path.Join(subpaths...)
 	if dir == "" {
 		dir = "."
 	}
-	tree := treeprint.New()
-	tree.SetValue(dir)
-	err := fs.WalkDir(fsys, dir, func(path string, de fs.DirEntry, err error) error {
+	root := &printNode{path: dir, name: dir}
+	root.info, root.err = fs.Stat(fsys, dir)
+	if root.err != nil && !ignoreError(root.err) {
+		return "", root.err
+	}
+	if root.isDir() {
+		if err := p.readDir(fsys, root, 1); err != nil {
+			return "", err
+		}
+	}
+	switch p.Format {
+	case PrintTree:
+		return p.printTree(root), nil
+	case PrintJSON:
+		return p.printJSON(root)
+	case PrintJSONFlat:
+		return p.printJSONFlat(root)
+	case PrintFind:
+		return p.printFind(root), nil
+	case PrintMarkdown:
+		return p.printMarkdown(root), nil
+	default:
+		return "", fmt.Errorf("virt: unknown print format %d", p.Format)
+	}
+}
+
+// printNode is a path that was visited while printing
+type printNode struct {
+	path     string
+	name     string
+	info     fs.FileInfo
+	link     string
+	err      error
+	children []*printNode
+}
+
+func (n *printNode) isDir() bool {
+	return n.info != nil && n.info.IsDir()
+}
+
+// readDir reads the directory's children until the depth limit. Permission and
+// not-exist errors are kept on the node that failed.
+func (p *Printer) readDir(fsys fs.FS, node *printNode, depth int) error {
+	if p.Depth > 0 && depth > p.Depth {
+		return nil
+	}
+	des, err := fs.ReadDir(fsys, node.path)
+	if err != nil {
+		if ignoreError(err) {
+			node.err = err
+			return nil
+		}
+		return err
+	}
+	for _, de := range des {
+		child := &printNode{
+			path: path.Join(node.path, de.Name()),
+			name: de.Name(),
+		}
+		node.children = append(node.children, child)
+		child.info, err = de.Info()
 		if err != nil {
 			if ignoreError(err) {
-				return nil
+				child.err = err
+				continue
 			}
 			return err
-		} else if path == "." {
-			return nil
 		}
-		parent := tree
-		for _, element := range strings.Split(filepath.ToSlash(path), "/") {
-			existing := parent.FindByValue(element)
-			if existing != nil {
-				parent = existing
+		if de.Type()&fs.ModeSymlink != 0 {
+			if link, err := readlink(fsys, child.path); err == nil {
+				child.link = link
+			}
+		}
+		if !de.IsDir() {
+			continue
+		}
+		if err := p.readDir(fsys, child, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collapse joins directories that only contain a single directory
+func (p *Printer) collapse(node *printNode) (name string, last *printNode) {
+	name = node.name
+	for p.Collapse && node.err == nil && len(node.children) == 1 && node.children[0].isDir() {
+		node = node.children[0]
+		name = path.Join(name, node.name)
+	}
+	return name, node
+}
+
+// value returns the name to print for a node
+func (p *Printer) value(name string, node *printNode) string {
+	if p.Slash && node.isDir() {
+		name += "/"
+	}
+	if p.Link && node.link != "" {
+		name += " -> " + node.link
+	}
+	return name
+}
+
+// details returns the enabled details of a node separated by spaces
+func (p *Printer) details(node *printNode) string {
+	if node.info == nil {
+		return ""
+	}
+	var details []string
+	if p.Mode {
+		details = append(details, node.info.Mode().String())
+	}
+	if p.Size {
+		details = append(details, strconv.FormatInt(node.info.Size(), 10))
+	}
+	if p.ModTime {
+		details = append(details, node.info.ModTime().Format("2006-01-02 15:04:05"))
+	}
+	return strings.Join(details, " ")
+}
+
+// walk calls fn for each node under root sorted by path
+func (p *Printer) walk(root *printNode, fn func(node *printNode)) {
+	var nodes []*printNode
+	var visit func(node *printNode)
+	visit = func(node *printNode) {
+		nodes = append(nodes, node)
+		for _, child := range node.children {
+			visit(child)
+		}
+	}
+	visit(root)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].path < nodes[j].path
+	})
+	for _, node := range nodes {
+		fn(node)
+	}
+}
+
+func (p *Printer) printTree(root *printNode) string {
+	tree := treeprint.New()
+	tree.SetValue(root.name)
+	if root.path == "." || root.info == nil {
+		p.printBranch(tree, root)
+		return tree.String()
+	}
+	// Subpaths are nested under each of their elements
+	elements := strings.Split(root.path, "/")
+	branch := treeprint.Tree(tree)
+	for _, element := range elements[:len(elements)-1] {
+		branch = branch.AddBranch(element)
+	}
+	last := *root
+	last.name = elements[len(elements)-1]
+	p.printBranch(branch, &printNode{path: root.path, children: []*printNode{&last}})
+	return tree.String()
+}
+
+// leafParent returns the root, or a parent holding the root as a leaf when the
+// root is a file, so printing a file lists the file itself.
+func leafParent(root *printNode) *printNode {
+	if root.info == nil || root.isDir() {
+		return root
+	}
+	leaf := *root
+	leaf.name = path.Base(root.path)
+	return &printNode{path: root.path, children: []*printNode{&leaf}}
+}
+
+func (p *Printer) printBranch(tree treeprint.Tree, node *printNode) {
+	for _, child := range node.children {
+		name, last := p.collapse(child)
+		value := p.value(name, last)
+		meta := p.details(last)
+		if !last.isDir() {
+			if meta == "" {
+				tree.AddNode(value)
 			} else {
-				parent = parent.AddBranch(element)
+				tree.AddMetaNode(meta, value)
 			}
+			continue
 		}
-		return nil
+		var branch treeprint.Tree
+		if meta == "" {
+			branch = tree.AddBranch(value)
+		} else {
+			branch = tree.AddMetaBranch(meta, value)
+		}
+		p.printBranch(branch, last)
+	}
+}
+
+func (p *Printer) printFind(root *printNode) string {
+	out := new(strings.Builder)
+	p.walk(root, func(node *printNode) {
+		if details := p.details(node); details != "" {
+			out.WriteString(details + " ")
+		}
+		out.WriteString(p.value(node.path, node))
+		if node.err != nil {
+			out.WriteString(" (error: " + node.err.Error() + ")")
+		}
+		out.WriteString("\n")
+	})
+	return out.String()
+}
+
+func (p *Printer) printMarkdown(root *printNode) string {
+	out := new(strings.Builder)
+	if root.err != nil {
+		fmt.Fprintf(out, "- `%s` (error: %s)\n", p.value(root.name, root), root.err)
+	}
+	p.printList(out, leafParent(root), 0)
+	return out.String()
+}
+
+func (p *Printer) printList(out *strings.Builder, node *printNode, indent int) {
+	for _, child := range node.children {
+		name, last := p.collapse(child)
+		out.WriteString(strings.Repeat("  ", indent))
+		fmt.Fprintf(out, "- `%s`", p.value(name, last))
+		var notes []string
+		if details := p.details(last); details != "" {
+			notes = append(notes, details)
+		}
+		if last.err != nil {
+			notes = append(notes, "error: "+last.err.Error())
+		}
+		if len(notes) > 0 {
+			out.WriteString(" (" + strings.Join(notes, ", ") + ")")
+		}
+		out.WriteString("\n")
+		p.printList(out, last, indent+1)
+	}
+}
+
+// printJSON is the JSON format of a printed path. Unlike the details in the
+// other formats, the size, mode and modification time are always included.
+type printJSON struct {
+	Path    string       `json:"path"`
+	Name    string       `json:"name"`
+	Size    int64        `json:"size"`
+	Mode    fs.FileMode  `json:"mode"`
+	ModTime *time.Time   `json:"modTime,omitempty"`
+	Link    string       `json:"link,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Entries []*printJSON `json:"entries,omitempty"`
+}
+
+func toPrintJSON(node *printNode) *printJSON {
+	pj := &printJSON{
+		Path: node.path,
+		Name: node.name,
+		Link: node.link,
+	}
+	if node.info != nil {
+		pj.Size = node.info.Size()
+		pj.Mode = node.info.Mode()
+		if modTime := node.info.ModTime(); !modTime.IsZero() {
+			pj.ModTime = &modTime
+		}
+	}
+	if node.err != nil {
+		pj.Error = node.err.Error()
+	}
+	return pj
+}
+
+func (p *Printer) printJSON(root *printNode) (string, error) {
+	var convert func(node *printNode) *printJSON
+	convert = func(node *printNode) *printJSON {
+		pj := toPrintJSON(node)
+		for _, child := range node.children {
+			pj.Entries = append(pj.Entries, convert(child))
+		}
+		return pj
+	}
+	out, err := json.MarshalIndent(convert(root), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+func (p *Printer) printJSONFlat(root *printNode) (string, error) {
+	entries := []*printJSON{}
+	p.walk(root, func(node *printNode) {
+		entries = append(entries, toPrintJSON(node))
 	})
+	out, err := json.MarshalIndent(entries, "", "  ")
 	if err != nil {
 		return "", err
 	}
-	return tree.String(), nil
+	return string(out) + "\n", nil
 }
 
 // Skip over permission errors and missing files. This is similar to ls.
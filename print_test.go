@@ -1,7 +1,10 @@
 package virt_test
 
 import (
+	"encoding/json"
+	"io/fs"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 	"github.com/matthewmueller/virt"
@@ -74,3 +77,275 @@ func TestUncommon(t *testing.T) {
 `
 	is.Equal(actual, expect)
 }
+
+func TestPrintSubpath(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["duo/view/index.jsx"] = &virt.File{}
+	tree["duo/controller/new.go"] = &virt.File{}
+	actual, err := virt.Print(tree, "duo")
+	is.NoErr(err)
+	expect := `duo
+└── duo
+    ├── controller
+    │   └── new.go
+    └── view
+        └── index.jsx
+`
+	is.Equal(actual, expect)
+	// Nested subpaths are printed beneath each of their elements
+	actual, err = virt.Print(tree, "duo/view")
+	is.NoErr(err)
+	is.Equal(actual, `duo/view
+└── duo
+    └── view
+        └── index.jsx
+`)
+}
+
+func TestPrintFile(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"a.txt":   &virt.File{Data: []byte("a")},
+		"b/c.txt": &virt.File{Data: []byte("c")},
+	}
+	actual, err := virt.Print(tree, "a.txt")
+	is.NoErr(err)
+	is.Equal(actual, "a.txt\n└── a.txt\n")
+	actual, err = virt.Print(tree, "b", "c.txt")
+	is.NoErr(err)
+	is.Equal(actual, "b/c.txt\n└── b\n    └── c.txt\n")
+	printer := &virt.Printer{Format: virt.PrintFind}
+	actual, err = printer.Print(tree, "b/c.txt")
+	is.NoErr(err)
+	is.Equal(actual, "b/c.txt\n")
+}
+
+func TestPrintDetails(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["a.txt"] = &virt.File{Data: []byte("hello"), Mode: 0600}
+	tree["bin/run"] = &virt.File{Data: []byte("#!/bin/sh\n"), Mode: 0755}
+	tree["link"] = &virt.File{Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777}
+	printer := &virt.Printer{Size: true, Mode: true, Link: true, Slash: true}
+	actual, err := printer.Print(tree)
+	is.NoErr(err)
+	expect := `.
+├── [-rw------- 5]  a.txt
+├── [d--------- 0]  bin/
+│   └── [-rwxr-xr-x 10]  run
+└── [Lrwxrwxrwx 5]  link -> a.txt
+`
+	is.Equal(actual, expect)
+}
+
+func TestPrintModTime(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["a.txt"] = &virt.File{ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	printer := &virt.Printer{ModTime: true}
+	actual, err := printer.Print(tree)
+	is.NoErr(err)
+	expect := `.
+└── [2024-01-02 03:04:05]  a.txt
+`
+	is.Equal(actual, expect)
+}
+
+func TestPrintDepth(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["a.txt"] = &virt.File{}
+	tree["duo/view/index.jsx"] = &virt.File{}
+	tree["duo/main.go"] = &virt.File{}
+	printer := &virt.Printer{Depth: 1, Slash: true}
+	actual, err := printer.Print(tree)
+	is.NoErr(err)
+	expect := `.
+├── a.txt
+└── duo/
+`
+	is.Equal(actual, expect)
+	printer = &virt.Printer{Depth: 2}
+	actual, err = printer.Print(tree)
+	is.NoErr(err)
+	expect = `.
+├── a.txt
+└── duo
+    ├── main.go
+    └── view
+`
+	is.Equal(actual, expect)
+}
+
+func TestPrintCollapse(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["another/whatever/cool/story.jsx"] = &virt.File{}
+	tree["duo/view/index.jsx"] = &virt.File{}
+	tree["duo/main.go"] = &virt.File{}
+	printer := &virt.Printer{Collapse: true}
+	actual, err := printer.Print(tree)
+	is.NoErr(err)
+	expect := `.
+├── another/whatever/cool
+│   └── story.jsx
+└── duo
+    ├── main.go
+    └── view
+        └── index.jsx
+`
+	is.Equal(actual, expect)
+}
+
+// deniedFS denies access to a directory
+type deniedFS struct {
+	fs.FS
+	dir string
+}
+
+func (d *deniedFS) Open(name string) (fs.File, error) {
+	if name == d.dir {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return d.FS.Open(name)
+}
+
+func TestPrintFind(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["a-b.txt"] = &virt.File{}
+	tree["a/b.txt"] = &virt.File{}
+	tree["link"] = &virt.File{Data: []byte("a/b.txt"), Mode: fs.ModeSymlink}
+	printer := &virt.Printer{Format: virt.PrintFind, Slash: true, Link: true}
+	actual, err := printer.Print(tree)
+	is.NoErr(err)
+	expect := `./
+a/
+a-b.txt
+a/b.txt
+link -> a/b.txt
+`
+	is.Equal(actual, expect)
+}
+
+func TestPrintMarkdown(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["another/whatever/story.jsx"] = &virt.File{}
+	tree["duo/view/index.jsx"] = &virt.File{Data: []byte("hi")}
+	tree["duo/main.go"] = &virt.File{}
+	printer := &virt.Printer{Format: virt.PrintMarkdown, Collapse: true, Slash: true}
+	actual, err := printer.Print(tree)
+	is.NoErr(err)
+	expect := "- `another/whatever/`\n" +
+		"  - `story.jsx`\n" +
+		"- `duo/`\n" +
+		"  - `main.go`\n" +
+		"  - `view/`\n" +
+		"    - `index.jsx`\n"
+	is.Equal(actual, expect)
+	printer = &virt.Printer{Format: virt.PrintMarkdown, Size: true, Depth: 1}
+	actual, err = printer.Print(tree)
+	is.NoErr(err)
+	expect = "- `another` (0)\n" +
+		"- `duo` (0)\n"
+	is.Equal(actual, expect)
+}
+
+func TestPrintJSON(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["a.txt"] = &virt.File{Data: []byte("hello"), Mode: 0644}
+	tree["duo/link"] = &virt.File{Data: []byte("../a.txt"), Mode: fs.ModeSymlink | 0777}
+	printer := &virt.Printer{Format: virt.PrintJSON}
+	actual, err := printer.Print(tree)
+	is.NoErr(err)
+	var root struct {
+		Path    string
+		Mode    fs.FileMode
+		Entries []struct {
+			Path    string
+			Name    string
+			Size    int64
+			Mode    fs.FileMode
+			Link    string
+			Entries []struct {
+				Path string
+				Link string
+			}
+		}
+	}
+	is.NoErr(json.Unmarshal([]byte(actual), &root))
+	is.Equal(root.Path, ".")
+	is.True(root.Mode.IsDir())
+	is.Equal(len(root.Entries), 2)
+	is.Equal(root.Entries[0].Path, "a.txt")
+	is.Equal(root.Entries[0].Size, int64(5))
+	is.Equal(root.Entries[0].Mode, fs.FileMode(0644))
+	is.Equal(root.Entries[1].Name, "duo")
+	is.Equal(len(root.Entries[1].Entries), 1)
+	is.Equal(root.Entries[1].Entries[0].Path, "duo/link")
+	is.Equal(root.Entries[1].Entries[0].Link, "../a.txt")
+}
+
+func TestPrintJSONFlat(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["a/b.txt"] = &virt.File{}
+	tree["a-b.txt"] = &virt.File{}
+	printer := &virt.Printer{Format: virt.PrintJSONFlat}
+	actual, err := printer.Print(tree)
+	is.NoErr(err)
+	var entries []struct {
+		Path    string
+		Entries []any
+	}
+	is.NoErr(json.Unmarshal([]byte(actual), &entries))
+	is.Equal(len(entries), 4)
+	is.Equal(entries[0].Path, ".")
+	is.Equal(entries[1].Path, "a")
+	is.Equal(entries[2].Path, "a-b.txt")
+	is.Equal(entries[3].Path, "a/b.txt")
+	for _, entry := range entries {
+		is.Equal(entry.Entries, nil)
+	}
+}
+
+func TestPrintErrors(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	tree["a.txt"] = &virt.File{}
+	tree["secret/key"] = &virt.File{}
+	fsys := &deniedFS{tree, "secret"}
+	// The tree format skips over errors
+	actual, err := virt.Print(fsys)
+	is.NoErr(err)
+	is.Equal(actual, ".\n├── a.txt\n└── secret\n")
+	// Other formats report them
+	printer := &virt.Printer{Format: virt.PrintFind}
+	actual, err = printer.Print(fsys)
+	is.NoErr(err)
+	is.Equal(actual, ".\na.txt\nsecret (error: open secret: permission denied)\n")
+	printer = &virt.Printer{Format: virt.PrintMarkdown}
+	actual, err = printer.Print(fsys)
+	is.NoErr(err)
+	is.Equal(actual, "- `a.txt`\n- `secret` (error: open secret: permission denied)\n")
+	printer = &virt.Printer{Format: virt.PrintJSONFlat}
+	actual, err = printer.Print(fsys)
+	is.NoErr(err)
+	var entries []struct {
+		Path  string
+		Error string
+	}
+	is.NoErr(json.Unmarshal([]byte(actual), &entries))
+	is.Equal(len(entries), 3)
+	is.Equal(entries[2].Path, "secret")
+	is.Equal(entries[2].Error, "open secret: permission denied")
+	// Missing directories are reported too
+	actual, err = printer.Print(tree, "missing")
+	is.NoErr(err)
+	is.NoErr(json.Unmarshal([]byte(actual), &entries))
+	is.Equal(len(entries), 1)
+	is.True(entries[0].Error != "")
+}
@@ -0,0 +1,321 @@
+package virt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Limits for a quota filesystem. Zero means unlimited.
+type Limits struct {
+	MaxBytes    int64 // Total size of all files
+	MaxFiles    int   // Number of files and symlinks, not including directories
+	MaxDepth    int   // Number of elements in a path, so "a/b.txt" is 2
+	MaxFileSize int64 // Size of a single file
+}
+
+// Usage of a quota filesystem
+type Usage struct {
+	Bytes int64
+	Files int
+}
+
+// QuotaError is returned within a *fs.PathError when a write would exceed one
+// of the limits.
+type QuotaError struct {
+	Limit string // "bytes", "files", "depth" or "file size"
+	Max   int64
+	Value int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("virt: %s quota exceeded: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+// Quota limits how much can be written to fsys. The existing files count
+// towards the limits. Writes that would exceed a limit fail with a *QuotaError
+// and leave the filesystem unchanged. Writes through files returned by
+// OpenFile are counted as they happen.
+//
+// Writes that don't go through the quota filesystem aren't counted.
+func Quota(fsys FS, limits Limits) (*QuotaFS, error) {
+	q := &QuotaFS{fs: fsys, limits: limits}
+	usage, err := q.measure(".")
+	if err != nil {
+		return nil, err
+	}
+	q.usage = usage
+	return q, nil
+}
+
+// QuotaFS is a filesystem with limits. It's safe to call Usage while writing.
+type QuotaFS struct {
+	fs     FS
+	limits Limits
+	mu     sync.Mutex
+	usage  Usage
+}
+
+var _ FS = (*QuotaFS)(nil)
+
+// Usage returns how much of the quota is used
+func (q *QuotaFS) Usage() Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage
+}
+
+func (q *QuotaFS) Open(name string) (fs.File, error) {
+	return q.fs.Open(name)
+}
+
+func (q *QuotaFS) Stat(name string) (fs.FileInfo, error) {
+	return q.fs.Stat(name)
+}
+
+func (q *QuotaFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(q.fs, name)
+}
+
+func (q *QuotaFS) Lstat(name string) (fs.FileInfo, error) {
+	return q.fs.Lstat(name)
+}
+
+func (q *QuotaFS) Readlink(name string) (string, error) {
+	return q.fs.Readlink(name)
+}
+
+func (q *QuotaFS) OpenFile(name string, flag int, perm fs.FileMode) (RWFile, error) {
+	if flag&writeFlags == 0 {
+		return q.fs.OpenFile(name, flag, perm)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Files are counted and sized by their targets when opened through links
+	size, exists := int64(0), false
+	if info, err := q.fs.Stat(name); err == nil && !info.IsDir() {
+		size, exists = info.Size(), true
+	}
+	if !exists && flag&os.O_CREATE != 0 {
+		if err := q.check("open", name, 0, 1); err != nil {
+			return nil, err
+		}
+	}
+	file, err := q.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if !exists && flag&os.O_CREATE != 0 {
+		q.usage.Files++
+	}
+	if flag&os.O_TRUNC != 0 {
+		q.usage.Bytes -= size
+		size = 0
+	}
+	return &quotaFile{file, q, name, flag, size, 0}, nil
+}
+
+func (q *QuotaFS) MkdirAll(path string, perm fs.FileMode) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.checkDepth("MkdirAll", path); err != nil {
+		return err
+	}
+	return q.fs.MkdirAll(path, perm)
+}
+
+func (q *QuotaFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.checkFileSize("WriteFile", name, int64(len(data))); err != nil {
+		return err
+	}
+	before := q.footprint(name)
+	// Some filesystems write through symlinks, while others replace them, so
+	// expect the link to stay when writing a file over it
+	expect := Usage{int64(len(data)), 1}
+	if info, err := q.fs.Lstat(name); err == nil && perm&fs.ModeSymlink == 0 && info.Mode()&fs.ModeSymlink != 0 {
+		expect.Bytes += info.Size()
+		expect.Files++
+	}
+	if err := q.check("WriteFile", name, expect.Bytes-before.Bytes, expect.Files-before.Files); err != nil {
+		return err
+	}
+	if err := q.fs.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	after := q.footprint(name)
+	q.usage.Bytes += after.Bytes - before.Bytes
+	q.usage.Files += after.Files - before.Files
+	return nil
+}
+
+// footprint is the usage of a file, or a symlink and the file it links to
+func (q *QuotaFS) footprint(name string) (usage Usage) {
+	info, err := q.fs.Lstat(name)
+	if err != nil || info.IsDir() {
+		return usage
+	}
+	usage = Usage{info.Size(), 1}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return usage
+	}
+	if info, err := q.fs.Stat(name); err == nil && !info.IsDir() {
+		usage.Bytes += info.Size()
+		usage.Files++
+	}
+	return usage
+}
+
+func (q *QuotaFS) RemoveAll(path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	removed, err := q.measure(path)
+	if err != nil {
+		return err
+	}
+	if err := q.fs.RemoveAll(path); err != nil {
+		return err
+	}
+	q.usage.Bytes -= removed.Bytes
+	q.usage.Files -= removed.Files
+	return nil
+}
+
+// measure the usage of the path and everything within it. Symlinks only count
+// as themselves, not their targets.
+func (q *QuotaFS) measure(dir string) (usage Usage, err error) {
+	info, err := q.fs.Lstat(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return usage, nil
+		}
+		return usage, err
+	} else if !info.IsDir() {
+		return Usage{info.Size(), 1}, nil
+	}
+	err = fs.WalkDir(q.fs, dir, func(fpath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+		info, err := q.fs.Lstat(fpath)
+		if err != nil {
+			return err
+		}
+		usage.Bytes += info.Size()
+		usage.Files++
+		return nil
+	})
+	return usage, err
+}
+
+// check that adding bytes and files to the path stays within the limits
+func (q *QuotaFS) check(op, path string, bytes int64, files int) error {
+	if err := q.checkDepth(op, path); err != nil {
+		return err
+	}
+	if max := q.limits.MaxBytes; max > 0 && bytes > 0 && q.usage.Bytes+bytes > max {
+		return quotaError(op, path, "bytes", max, q.usage.Bytes+bytes)
+	}
+	if max := q.limits.MaxFiles; max > 0 && files > 0 && q.usage.Files+files > max {
+		return quotaError(op, path, "files", int64(max), int64(q.usage.Files+files))
+	}
+	return nil
+}
+
+func (q *QuotaFS) checkDepth(op, path string) error {
+	depth := strings.Count(path, "/") + 1
+	if max := q.limits.MaxDepth; max > 0 && depth > max {
+		return quotaError(op, path, "depth", int64(max), int64(depth))
+	}
+	return nil
+}
+
+func (q *QuotaFS) checkFileSize(op, path string, size int64) error {
+	if max := q.limits.MaxFileSize; max > 0 && size > max {
+		return quotaError(op, path, "file size", max, size)
+	}
+	return nil
+}
+
+func quotaError(op, path, limit string, max, value int64) error {
+	return &fs.PathError{
+		Op:   op,
+		Path: path,
+		Err:  &QuotaError{limit, max, value},
+	}
+}
+
+// quotaFile counts the bytes written through an open file
+type quotaFile struct {
+	RWFile
+	q      *QuotaFS
+	name   string
+	flag   int
+	size   int64
+	offset int64
+}
+
+var _ fs.ReadDirFile = (*quotaFile)(nil)
+var _ io.Seeker = (*quotaFile)(nil)
+
+func (f *quotaFile) Write(p []byte) (int, error) {
+	f.q.mu.Lock()
+	defer f.q.mu.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = f.size
+	}
+	end := f.offset + int64(len(p))
+	if err := f.q.checkFileSize("write", f.name, end); err != nil {
+		return 0, err
+	}
+	if grow := end - f.size; grow > 0 {
+		if err := f.q.check("write", f.name, grow, 0); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.RWFile.Write(p)
+	f.offset += int64(n)
+	if f.offset > f.size {
+		f.q.usage.Bytes += f.offset - f.size
+		f.size = f.offset
+	}
+	return n, err
+}
+
+func (f *quotaFile) Read(p []byte) (int, error) {
+	n, err := f.RWFile.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *quotaFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f.RWFile.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errors.ErrUnsupported}
+	}
+	offset, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *quotaFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := f.RWFile.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotADirectory}
+	}
+	return dir.ReadDir(n)
+}
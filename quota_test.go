@@ -0,0 +1,165 @@
+package virt_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestQuotaUsage(t *testing.T) {
+	is := is.New(t)
+	fsys, err := virt.Quota(virt.Tree{
+		"a.txt":   &virt.File{Data: []byte("aa")},
+		"b/b.txt": &virt.File{Data: []byte("bbb")},
+	}, virt.Limits{})
+	is.NoErr(err)
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 5, Files: 2})
+	is.NoErr(fsys.WriteFile("c.txt", []byte("c"), 0644))
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 6, Files: 3})
+	// Overwriting replaces the size
+	is.NoErr(fsys.WriteFile("a.txt", []byte("a"), 0644))
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 5, Files: 3})
+	is.NoErr(fsys.RemoveAll("b"))
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 2, Files: 2})
+	is.NoErr(fsys.RemoveAll("missing"))
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 2, Files: 2})
+}
+
+func quotaError(t testing.TB, err error) *virt.QuotaError {
+	t.Helper()
+	var quotaErr *virt.QuotaError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("expected a path error, got %T", err)
+	}
+	return quotaErr
+}
+
+func TestQuotaLimits(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	fsys, err := virt.Quota(tree, virt.Limits{
+		MaxBytes:    10,
+		MaxFiles:    3,
+		MaxDepth:    2,
+		MaxFileSize: 6,
+	})
+	is.NoErr(err)
+	is.NoErr(fsys.WriteFile("a.txt", []byte("aaaaaa"), 0644))
+	// File size
+	err = fsys.WriteFile("b.txt", []byte("bbbbbbb"), 0644)
+	is.Equal(quotaError(t, err).Limit, "file size")
+	is.Equal(err.Error(), "WriteFile b.txt: virt: file size quota exceeded: 7 > 6")
+	// Total bytes
+	err = fsys.WriteFile("b.txt", []byte("bbbbb"), 0644)
+	is.Equal(quotaError(t, err).Limit, "bytes")
+	// Depth
+	err = fsys.WriteFile("a/b/c.txt", []byte("c"), 0644)
+	is.Equal(quotaError(t, err).Limit, "depth")
+	err = fsys.MkdirAll("a/b/c", 0755)
+	is.Equal(quotaError(t, err).Limit, "depth")
+	is.NoErr(fsys.MkdirAll("a/b", 0755))
+	// Files
+	is.NoErr(fsys.WriteFile("b.txt", []byte("b"), 0644))
+	is.NoErr(fsys.WriteFile("c.txt", []byte("c"), 0644))
+	err = fsys.WriteFile("d.txt", []byte("d"), 0644)
+	is.Equal(quotaError(t, err).Limit, "files")
+	// Failed writes leave the filesystem unchanged
+	_, ok := tree["d.txt"]
+	is.True(!ok)
+	is.Equal(string(tree["a.txt"].Data), "aaaaaa")
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 8, Files: 3})
+}
+
+func TestQuotaOpenFile(t *testing.T) {
+	is := is.New(t)
+	fsys, err := virt.Quota(virt.Tree{}, virt.Limits{MaxBytes: 8, MaxFiles: 1, MaxFileSize: 6})
+	is.NoErr(err)
+	file, err := fsys.OpenFile("a.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	is.NoErr(err)
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 0, Files: 1})
+	n, err := file.Write([]byte("aaaa"))
+	is.NoErr(err)
+	is.Equal(n, 4)
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 4, Files: 1})
+	// Past the file size limit
+	_, err = file.Write([]byte("aaa"))
+	is.Equal(quotaError(t, err).Limit, "file size")
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 4, Files: 1})
+	is.NoErr(file.Close())
+	// Overwriting doesn't count twice
+	file, err = fsys.OpenFile("a.txt", os.O_WRONLY, 0644)
+	is.NoErr(err)
+	_, err = file.Write([]byte("bbbbb"))
+	is.NoErr(err)
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 5, Files: 1})
+	is.NoErr(file.Close())
+	// Truncating frees the bytes
+	file, err = fsys.OpenFile("a.txt", os.O_WRONLY|os.O_TRUNC, 0644)
+	is.NoErr(err)
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 0, Files: 1})
+	is.NoErr(file.Close())
+	// Creating another file exceeds the file limit
+	_, err = fsys.OpenFile("b.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	is.Equal(quotaError(t, err).Limit, "files")
+}
+
+func TestQuotaOS(t *testing.T) {
+	is := is.New(t)
+	fsys, err := virt.Quota(virt.OS(t.TempDir()), virt.Limits{MaxBytes: 4})
+	is.NoErr(err)
+	file, err := fsys.OpenFile("a.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	is.NoErr(err)
+	defer file.Close()
+	_, err = file.Write([]byte("aaa"))
+	is.NoErr(err)
+	_, err = file.Write([]byte("aa"))
+	is.Equal(quotaError(t, err).Limit, "bytes")
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 3, Files: 1})
+	info, err := fsys.Stat("a.txt")
+	is.NoErr(err)
+	is.Equal(info.Size(), int64(3))
+}
+
+func TestQuotaSymlink(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"dir/a.txt": &virt.File{Data: []byte("aaa"), Mode: 0644},
+		"link":      &virt.File{Data: []byte("dir"), Mode: fs.ModeSymlink | 0777},
+	}
+	fsys, err := virt.Quota(tree, virt.Limits{})
+	is.NoErr(err)
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 6, Files: 2})
+	// Removing the link only frees the link
+	is.NoErr(fsys.RemoveAll("link"))
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 3, Files: 1})
+	is.Equal(string(tree["dir/a.txt"].Data), "aaa")
+}
+
+func TestQuotaSymlinkOS(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("aaa"), 0644))
+	is.NoErr(os.Symlink("a.txt", filepath.Join(dir, "link")))
+	fsys, err := virt.Quota(virt.OS(dir), virt.Limits{MaxBytes: 10})
+	is.NoErr(err)
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 8, Files: 2})
+	// The OS writes through the link, so the target grows
+	is.NoErr(fsys.WriteFile("link", []byte("aaaaa"), 0644))
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 10, Files: 2})
+	err = fsys.WriteFile("link", []byte("aaaaaa"), 0644)
+	is.Equal(quotaError(t, err).Limit, "bytes")
+	is.NoErr(fsys.RemoveAll("link"))
+	is.Equal(fsys.Usage(), virt.Usage{Bytes: 5, Files: 1})
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "aaaaa")
+}
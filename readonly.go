@@ -0,0 +1,121 @@
+package virt
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// ReadOnly returns a filesystem that can't be modified. Reads pass through to
+// fsys, while OpenFile with write flags, WriteFile, MkdirAll and RemoveAll fail
+// with fs.ErrPermission. Use this when handing a filesystem to code that should
+// only read from it.
+func ReadOnly(fsys fs.FS) FS {
+	return &readOnlyFS{fsys}
+}
+
+type readOnlyFS struct {
+	fs fs.FS
+}
+
+var _ FS = (*readOnlyFS)(nil)
+var _ fs.SubFS = (*readOnlyFS)(nil)
+var _ fs.ReadDirFS = (*readOnlyFS)(nil)
+var _ fs.ReadFileFS = (*readOnlyFS)(nil)
+
+// Flags that modify the filesystem
+const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_CREATE | os.O_EXCL | os.O_TRUNC | os.O_APPEND
+
+func (r *readOnlyFS) Open(name string) (fs.File, error) {
+	file, err := r.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{file, name}, nil
+}
+
+func (r *readOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(r.fs, name)
+}
+
+func (r *readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(r.fs, name)
+}
+
+func (r *readOnlyFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(r.fs, name)
+}
+
+func (r *readOnlyFS) Lstat(name string) (fs.FileInfo, error) {
+	return lstat(r.fs, name)
+}
+
+func (r *readOnlyFS) Readlink(name string) (string, error) {
+	return readlink(r.fs, name)
+}
+
+// Sub returns a read-only filesystem rooted at dir. Implements fs.SubFS.
+func (r *readOnlyFS) Sub(dir string) (fs.FS, error) {
+	fsys, err := Sub(r.fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	return ReadOnly(fsys), nil
+}
+
+// OpenFile opens the file for reading. Any flags that would modify the
+// filesystem fail with fs.ErrPermission.
+func (r *readOnlyFS) OpenFile(name string, flag int, perm fs.FileMode) (RWFile, error) {
+	if flag&writeFlags != 0 {
+		return nil, &fs.PathError{Op: "OpenFile", Path: name, Err: fs.ErrPermission}
+	}
+	file, err := r.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{file, name}, nil
+}
+
+func (r *readOnlyFS) MkdirAll(name string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "MkdirAll", Path: name, Err: fs.ErrPermission}
+}
+
+func (r *readOnlyFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return &fs.PathError{Op: "WriteFile", Path: name, Err: fs.ErrPermission}
+}
+
+func (r *readOnlyFS) RemoveAll(name string) error {
+	return &fs.PathError{Op: "RemoveAll", Path: name, Err: fs.ErrPermission}
+}
+
+// readOnlyFile hides the underlying file, so it can't be written to through a
+// type assertion
+type readOnlyFile struct {
+	fs.File
+	name string
+}
+
+var _ RWFile = (*readOnlyFile)(nil)
+var _ fs.ReadDirFile = (*readOnlyFile)(nil)
+var _ io.Seeker = (*readOnlyFile)(nil)
+
+func (f *readOnlyFile) Write(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
+
+func (f *readOnlyFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotADirectory}
+	}
+	return dir.ReadDir(n)
+}
+
+func (f *readOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errors.ErrUnsupported}
+	}
+	return seeker.Seek(offset, whence)
+}
@@ -0,0 +1,93 @@
+package virt_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestReadOnlyRead(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.ReadOnly(virt.Tree{
+		"a.txt":   &virt.File{Data: []byte("a"), Mode: 0644},
+		"b/b.txt": &virt.File{Data: []byte("b"), Mode: 0644},
+	})
+	is.NoErr(fstest.TestFS(fsys, "a.txt", "b/b.txt"))
+	file, err := fsys.OpenFile("a.txt", os.O_RDONLY, 0)
+	is.NoErr(err)
+	defer file.Close()
+	buf := make([]byte, 1)
+	_, err = file.Read(buf)
+	is.NoErr(err)
+	is.Equal(string(buf), "a")
+}
+
+func TestReadOnlySymlink(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.ReadOnly(virt.Tree{
+		"a.txt": &virt.File{Data: []byte("a"), Mode: 0644},
+		"b.txt": &virt.File{Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777},
+	})
+	info, err := fsys.Lstat("b.txt")
+	is.NoErr(err)
+	is.True(info.Mode()&fs.ModeSymlink != 0)
+	target, err := fsys.Readlink("b.txt")
+	is.NoErr(err)
+	is.Equal(target, "a.txt")
+	data, err := fs.ReadFile(fsys, "b.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+}
+
+func TestReadOnlyWrite(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"a.txt": &virt.File{Data: []byte("a"), Mode: 0644},
+	}
+	fsys := virt.ReadOnly(tree)
+	err := fsys.WriteFile("a.txt", []byte("b"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	err = fsys.MkdirAll("b", 0755)
+	is.True(errors.Is(err, fs.ErrPermission))
+	err = fsys.RemoveAll("a.txt")
+	is.True(errors.Is(err, fs.ErrPermission))
+	for _, flag := range []int{os.O_WRONLY, os.O_RDWR, os.O_CREATE, os.O_TRUNC, os.O_APPEND} {
+		_, err = fsys.OpenFile("a.txt", flag, 0644)
+		is.True(errors.Is(err, fs.ErrPermission))
+		var pathErr *fs.PathError
+		is.True(errors.As(err, &pathErr))
+	}
+	// Files opened for reading can't be written to
+	file, err := fsys.OpenFile("a.txt", os.O_RDONLY, 0)
+	is.NoErr(err)
+	_, err = file.Write([]byte("b"))
+	is.True(errors.Is(err, fs.ErrPermission))
+	is.NoErr(file.Close())
+	opened, err := fsys.Open("a.txt")
+	is.NoErr(err)
+	_, err = opened.(virt.RWFile).Write([]byte("b"))
+	is.True(errors.Is(err, fs.ErrPermission))
+	is.NoErr(opened.Close())
+	// Nothing changed
+	is.Equal(len(tree), 1)
+	is.Equal(string(tree["a.txt"].Data), "a")
+}
+
+func TestReadOnlySub(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.ReadOnly(virt.Tree{
+		"b/b.txt": &virt.File{Data: []byte("b"), Mode: 0644},
+	})
+	sub, err := fs.Sub(fsys, "b")
+	is.NoErr(err)
+	data, err := fs.ReadFile(sub, "b.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "b")
+	err = sub.(virt.FS).WriteFile("b.txt", []byte("c"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+}
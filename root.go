@@ -0,0 +1,130 @@
+//go:build go1.25
+
+package virt
+
+import (
+	"io/fs"
+	"os"
+)
+
+// Root is like OS, but every operation is confined to the directory, even
+// through symlinks. Paths that resolve outside of the directory return an
+// error rather than reading or writing there. Symlinks may still be created
+// with targets outside of the directory, they just can't be followed.
+//
+// Root uses os.Root, so it's safe against symlinks that are swapped in while
+// an operation is in progress. It's slower than OS because the directory is
+// opened for each operation. Root is only available when built with Go 1.25 or
+// later.
+type Root string
+
+var _ FS = (Root)("")
+
+// open the root directory for a single operation
+func (dir Root) open(op, name string) (*os.Root, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return os.OpenRoot(string(dir))
+}
+
+func (dir Root) Open(name string) (fs.File, error) {
+	root, err := dir.open("open", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	// Files stay open after the root is closed
+	file, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (dir Root) Stat(name string) (fs.FileInfo, error) {
+	root, err := dir.open("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return root.Stat(name)
+}
+
+func (dir Root) ReadDir(name string) ([]fs.DirEntry, error) {
+	root, err := dir.open("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return fs.ReadDir(root.FS(), name)
+}
+
+func (dir Root) Lstat(name string) (fs.FileInfo, error) {
+	root, err := dir.open("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return root.Lstat(name)
+}
+
+func (dir Root) Readlink(name string) (string, error) {
+	root, err := dir.open("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+	// Match the virtual filesystems, which return fs.ErrInvalid for paths that
+	// aren't symlinks.
+	info, err := root.Lstat(name)
+	if err != nil {
+		return "", err
+	} else if info.Mode()&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return root.Readlink(name)
+}
+
+func (dir Root) OpenFile(name string, flag int, perm fs.FileMode) (RWFile, error) {
+	root, err := dir.open("open", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	file, err := root.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (dir Root) MkdirAll(path string, perm fs.FileMode) error {
+	root, err := dir.open("mkdirall", path)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	return root.MkdirAll(path, perm)
+}
+
+func (dir Root) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	root, err := dir.open("WriteFile", name)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	if perm&fs.ModeSymlink != 0 {
+		return root.Symlink(string(data), name)
+	}
+	return root.WriteFile(name, data, perm)
+}
+
+func (dir Root) RemoveAll(path string) error {
+	root, err := dir.open("RemoveAll", path)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	return root.RemoveAll(path)
+}
@@ -0,0 +1,94 @@
+//go:build go1.25
+
+package virt_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestRootRead(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	is.NoErr(os.MkdirAll(filepath.Join(dir, "b"), 0755))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "b/b.txt"), []byte("b"), 0644))
+	fsys := virt.Root(dir)
+	err := fstest.TestFS(fsys, "a.txt", "b/b.txt")
+	is.NoErr(err)
+}
+
+func TestRootSymlinkInside(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	is.NoErr(os.MkdirAll(filepath.Join(dir, "b"), 0755))
+	is.NoErr(os.Symlink("../a.txt", filepath.Join(dir, "b/link.txt")))
+	fsys := virt.Root(dir)
+	target, err := fsys.Readlink("b/link.txt")
+	is.NoErr(err)
+	is.Equal(target, "../a.txt")
+	data, err := fs.ReadFile(fsys, "b/link.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+	is.NoErr(fsys.WriteFile("b/link.txt", []byte("aa"), 0644))
+	data, err = os.ReadFile(filepath.Join(dir, "a.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "aa")
+}
+
+func TestRootSymlinkEscape(t *testing.T) {
+	is := is.New(t)
+	outside := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+	dir := t.TempDir()
+	is.NoErr(os.Symlink(outside, filepath.Join(dir, "escape")))
+	is.NoErr(os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "secret.txt")))
+	fsys := virt.Root(dir)
+	// Reads can't follow the links outside
+	_, err := fs.ReadFile(fsys, "escape/secret.txt")
+	is.True(err != nil)
+	_, err = fs.ReadFile(fsys, "secret.txt")
+	is.True(err != nil)
+	_, err = fsys.Stat("escape")
+	is.True(err != nil)
+	_, err = fsys.ReadDir("escape")
+	is.True(err != nil)
+	// The links themselves are still visible
+	info, err := fsys.Lstat("escape")
+	is.NoErr(err)
+	is.True(info.Mode()&fs.ModeSymlink != 0)
+	// Writes can't follow the links outside
+	is.True(fsys.WriteFile("escape/new.txt", []byte("new"), 0644) != nil)
+	is.True(fsys.WriteFile("secret.txt", []byte("overwritten"), 0644) != nil)
+	is.True(fsys.MkdirAll("escape/dir", 0755) != nil)
+	_, err = fsys.OpenFile("escape/new.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	is.True(err != nil)
+	// Removing the link doesn't remove its target
+	is.True(fsys.RemoveAll("escape/secret.txt") != nil)
+	is.NoErr(fsys.RemoveAll("escape"))
+	// Nothing outside was changed
+	data, err := os.ReadFile(filepath.Join(outside, "secret.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "secret")
+	_, err = os.Stat(filepath.Join(outside, "new.txt"))
+	is.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(outside, "dir"))
+	is.True(os.IsNotExist(err))
+}
+
+func TestRootInvalidPath(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	fsys := virt.Root(dir)
+	err := fsys.WriteFile("../a.txt", []byte("a"), 0644)
+	is.True(err != nil)
+	_, err = os.Stat(filepath.Join(filepath.Dir(dir), "a.txt"))
+	is.True(os.IsNotExist(err))
+}
@@ -1,75 +1,290 @@
 package virt
 
 import (
+	"errors"
+	"fmt"
 	"io/fs"
 	"path"
+	"strings"
 )
 
-// Sub returns a new filesystem rooted at dir.
-func Sub(fsys FS, dir string) (FS, error) {
+// SubOption configures the filesystem returned by Sub
+type SubOption func(*subFS)
+
+// ConfineSymlinks resolves symlinks within the sub filesystem itself, relative
+// to the directory containing the link. Links with absolute targets or targets
+// that climb out of the sub directory fail with fs.ErrPermission. Use this
+// when handing a sub filesystem to untrusted code.
+func ConfineSymlinks() SubOption {
+	return func(s *subFS) {
+		s.confine = true
+	}
+}
+
+// Sub returns a new filesystem rooted at dir. If fsys doesn't implement FS, the
+// returned filesystem is read-only and writes fail with fs.ErrPermission.
+func Sub(fsys fs.FS, dir string, options ...SubOption) (FS, error) {
 	if !fs.ValidPath(dir) {
 		return nil, &fs.PathError{Op: "Sub", Path: dir, Err: fs.ErrInvalid}
 	}
-	return &subFS{dir, fsys}, nil
+	s := &subFS{dir: dir, fs: fsys}
+	for _, option := range options {
+		option(s)
+	}
+	return s, nil
 }
 
 type subFS struct {
-	dir string
-	fs  FS
+	dir     string
+	fs      fs.FS
+	confine bool
+}
+
+var _ FS = (*subFS)(nil)
+var _ fs.SubFS = (*subFS)(nil)
+var _ fs.ReadDirFS = (*subFS)(nil)
+var _ fs.ReadFileFS = (*subFS)(nil)
+
+// Maximum number of symlinks to follow when confining symlinks
+const maxSymlinks = 255
+
+// Returned when resolving a path follows more than maxSymlinks symlinks
+var errTooManySymlinks = errors.New("virt: too many symlinks")
+
+// Returned when a symlink resolves outside of the sub directory
+var errSymlinkEscape = fmt.Errorf("virt: symlink escapes sub directory: %w", fs.ErrPermission)
+
+// lstatFS and readlinkFS are optionally implemented by read-only filesystems
+type lstatFS interface {
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// lstat the path without following symlinks when the filesystem supports it
+func lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys, ok := fsys.(lstatFS); ok {
+		return fsys.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+type readlinkFS interface {
+	Readlink(name string) (string, error)
+}
+
+// readlink returns the symlink target when the filesystem supports it. Also
+// supports filesystems that implement io/fs.ReadLinkFS from Go 1.25.
+func readlink(fsys fs.FS, name string) (string, error) {
+	switch fsys := fsys.(type) {
+	case readlinkFS:
+		return fsys.Readlink(name)
+	case interface{ ReadLink(name string) (string, error) }:
+		return fsys.ReadLink(name)
+	}
+	return "", &fs.PathError{Op: "Readlink", Path: name, Err: fs.ErrInvalid}
+}
+
+// Sub returns a filesystem rooted at dir within this sub filesystem. Implements
+// fs.SubFS.
+func (s *subFS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "Sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if s.confine {
+		// Resolve the new root now, so it can't be a link out of this directory
+		resolved, err := s.resolve("Sub", dir, true)
+		if err != nil {
+			return nil, err
+		}
+		dir = resolved
+	}
+	return &subFS{path.Join(s.dir, dir), s.fs, s.confine}, nil
 }
 
 func (s *subFS) Open(name string) (fs.File, error) {
-	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{Op: "OpenFile", Path: name, Err: fs.ErrInvalid}
+	fpath, err := s.path("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.fs.Open(fpath)
+}
+
+func (s *subFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fpath, err := s.path("ReadDir", name, true)
+	if err != nil {
+		return nil, err
 	}
-	return s.fs.Open(path.Join(s.dir, name))
+	return fs.ReadDir(s.fs, fpath)
+}
+
+func (s *subFS) ReadFile(name string) ([]byte, error) {
+	fpath, err := s.path("ReadFile", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(s.fs, fpath)
 }
 
 func (s *subFS) Stat(name string) (fs.FileInfo, error) {
-	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{Op: "Stat", Path: name, Err: fs.ErrInvalid}
+	fpath, err := s.path("Stat", name, true)
+	if err != nil {
+		return nil, err
 	}
-	return s.fs.Stat(path.Join(s.dir, name))
+	info, err := fs.Stat(s.fs, fpath)
+	if err != nil {
+		return nil, err
+	}
+	// Stat returns the original name, but size, mode, and modTime of the target
+	if fpath != path.Join(s.dir, name) {
+		return &fileInfo{
+			path:    name,
+			size:    info.Size(),
+			mode:    info.Mode(),
+			modTime: info.ModTime(),
+		}, nil
+	}
+	return info, nil
 }
 
 func (s *subFS) Lstat(name string) (fs.FileInfo, error) {
-	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{Op: "Lstat", Path: name, Err: fs.ErrInvalid}
+	fpath, err := s.path("Lstat", name, false)
+	if err != nil {
+		return nil, err
 	}
-	return s.fs.Lstat(path.Join(s.dir, name))
+	return s.lstat(fpath)
 }
 
 func (s *subFS) Readlink(name string) (string, error) {
-	if !fs.ValidPath(name) {
-		return "", &fs.PathError{Op: "Readlink", Path: name, Err: fs.ErrInvalid}
+	fpath, err := s.path("Readlink", name, false)
+	if err != nil {
+		return "", err
 	}
-	return s.fs.Readlink(path.Join(s.dir, name))
+	return s.readlink(fpath)
 }
 
 func (s *subFS) OpenFile(name string, flag int, perm fs.FileMode) (RWFile, error) {
-	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{Op: "OpenFile", Path: name, Err: fs.ErrInvalid}
+	fpath, err := s.path("OpenFile", name, true)
+	if err != nil {
+		return nil, err
 	}
-	return s.fs.OpenFile(path.Join(s.dir, name), flag, perm)
+	fsys, ok := s.fs.(FS)
+	if !ok {
+		return nil, &fs.PathError{Op: "OpenFile", Path: name, Err: fs.ErrPermission}
+	}
+	return fsys.OpenFile(fpath, flag, perm)
 }
 
 func (s *subFS) MkdirAll(name string, perm fs.FileMode) error {
-	if !fs.ValidPath(name) {
-		return &fs.PathError{Op: "MkdirAll", Path: name, Err: fs.ErrInvalid}
+	fpath, err := s.path("MkdirAll", name, true)
+	if err != nil {
+		return err
 	}
-	return s.fs.MkdirAll(path.Join(s.dir, name), perm)
+	fsys, ok := s.fs.(FS)
+	if !ok {
+		return &fs.PathError{Op: "MkdirAll", Path: name, Err: fs.ErrPermission}
+	}
+	return fsys.MkdirAll(fpath, perm)
 }
 
 func (s *subFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
-	if !fs.ValidPath(name) {
-		return &fs.PathError{Op: "WriteFile", Path: name, Err: fs.ErrInvalid}
+	// Don't follow the last element when writing a symlink
+	fpath, err := s.path("WriteFile", name, perm&fs.ModeSymlink == 0)
+	if err != nil {
+		return err
+	}
+	fsys, ok := s.fs.(FS)
+	if !ok {
+		return &fs.PathError{Op: "WriteFile", Path: name, Err: fs.ErrPermission}
 	}
-	return s.fs.WriteFile(path.Join(s.dir, name), data, perm)
+	return fsys.WriteFile(fpath, data, perm)
 }
 
 func (s *subFS) RemoveAll(name string) error {
+	fpath, err := s.path("RemoveAll", name, false)
+	if err != nil {
+		return err
+	}
+	fsys, ok := s.fs.(FS)
+	if !ok {
+		return &fs.PathError{Op: "RemoveAll", Path: name, Err: fs.ErrPermission}
+	}
+	return fsys.RemoveAll(fpath)
+}
+
+// path validates name and returns the path within the underlying filesystem
+func (s *subFS) path(op, name string, followLast bool) (string, error) {
 	if !fs.ValidPath(name) {
-		return &fs.PathError{Op: "RemoveAll", Path: name, Err: fs.ErrInvalid}
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if !s.confine {
+		return path.Join(s.dir, name), nil
+	}
+	resolved, err := s.resolve(op, name, followLast)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.dir, resolved), nil
+}
+
+// resolve walks name one element at a time, following symlinks relative to the
+// sub directory. Returns the resolved path relative to the sub directory.
+func (s *subFS) resolve(op, name string, followLast bool) (string, error) {
+	if name == "." {
+		return name, nil
 	}
-	return s.fs.RemoveAll(path.Join(s.dir, name))
+	elements := strings.Split(name, "/")
+	resolved := "."
+	links := 0
+	for len(elements) > 0 {
+		element := elements[0]
+		elements = elements[1:]
+		if element == "" || element == "." {
+			continue
+		}
+		next := path.Join(resolved, element)
+		if len(elements) == 0 && !followLast {
+			resolved = next
+			break
+		}
+		info, err := s.lstat(path.Join(s.dir, next))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// Let the underlying filesystem report the missing path
+				resolved = path.Join(append([]string{next}, elements...)...)
+				break
+			}
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		links++
+		if links > maxSymlinks {
+			return "", &fs.PathError{Op: op, Path: name, Err: errTooManySymlinks}
+		}
+		target, err := s.readlink(path.Join(s.dir, next))
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(target, "/") || strings.Contains(target, `\`) {
+			return "", &fs.PathError{Op: op, Path: name, Err: errSymlinkEscape}
+		}
+		// Targets are relative to the directory containing the link
+		target = path.Join(resolved, target)
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return "", &fs.PathError{Op: op, Path: name, Err: errSymlinkEscape}
+		}
+		// Start over from the link target
+		elements = append(strings.Split(target, "/"), elements...)
+		resolved = "."
+	}
+	return resolved, nil
+}
+
+func (s *subFS) lstat(fpath string) (fs.FileInfo, error) {
+	return lstat(s.fs, fpath)
+}
+
+func (s *subFS) readlink(fpath string) (string, error) {
+	return readlink(s.fs, fpath)
 }
@@ -0,0 +1,137 @@
+package virt_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestSub(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"a/b.txt":   &virt.File{Data: []byte("b")},
+		"a/c/d.txt": &virt.File{Data: []byte("d")},
+		"e.txt":     &virt.File{Data: []byte("e")},
+	}
+	fsys, err := virt.Sub(tree, "a")
+	is.NoErr(err)
+	is.NoErr(fstest.TestFS(fsys, "b.txt", "c/d.txt"))
+	data, err := fs.ReadFile(fsys, "c/d.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "d")
+	// Writes go to the underlying filesystem
+	is.NoErr(fsys.WriteFile("f.txt", []byte("f"), 0644))
+	is.Equal(string(tree["a/f.txt"].Data), "f")
+}
+
+func TestSubFS(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"a/b/c.txt": &virt.File{Data: []byte("c")},
+	}
+	fsys, err := virt.Sub(tree, "a")
+	is.NoErr(err)
+	_, ok := fsys.(fs.SubFS)
+	is.True(ok)
+	sub, err := fs.Sub(fsys, "b")
+	is.NoErr(err)
+	vsub, ok := sub.(virt.FS)
+	is.True(ok)
+	is.NoErr(vsub.WriteFile("d.txt", []byte("d"), 0644))
+	is.Equal(string(tree["a/b/d.txt"].Data), "d")
+	data, err := fs.ReadFile(sub, "c.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "c")
+}
+
+func TestSubReadOnly(t *testing.T) {
+	is := is.New(t)
+	mapfs := fstest.MapFS{
+		"a/b.txt": &fstest.MapFile{Data: []byte("b")},
+	}
+	fsys, err := virt.Sub(mapfs, "a")
+	is.NoErr(err)
+	data, err := fs.ReadFile(fsys, "b.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "b")
+	info, err := fsys.Lstat("b.txt")
+	is.NoErr(err)
+	is.Equal(info.Name(), "b.txt")
+	err = fsys.WriteFile("c.txt", []byte("c"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	err = fsys.MkdirAll("d", 0755)
+	is.True(errors.Is(err, fs.ErrPermission))
+	err = fsys.RemoveAll("b.txt")
+	is.True(errors.Is(err, fs.ErrPermission))
+	_, err = fsys.OpenFile("b.txt", os.O_RDWR, 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+}
+
+func TestSubConfineSymlinks(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"secret.txt":      &virt.File{Data: []byte("secret"), Mode: 0600},
+		"sub/a.txt":       &virt.File{Data: []byte("a"), Mode: 0644},
+		"sub/secret.txt":  &virt.File{Data: []byte("../secret.txt"), Mode: 0777 | fs.ModeSymlink},
+		"sub/link.txt":    &virt.File{Data: []byte("a.txt"), Mode: 0777 | fs.ModeSymlink},
+		"sub/dir/up.txt":  &virt.File{Data: []byte("../a.txt"), Mode: 0777 | fs.ModeSymlink},
+		"sub/dir/abs.txt": &virt.File{Data: []byte("/secret.txt"), Mode: 0777 | fs.ModeSymlink},
+	}
+	fsys, err := virt.Sub(tree, "sub", virt.ConfineSymlinks())
+	is.NoErr(err)
+
+	// Links within the sub directory resolve
+	info, err := fsys.Stat("link.txt")
+	is.NoErr(err)
+	is.Equal(info.Name(), "link.txt")
+	is.Equal(info.Size(), int64(1))
+	data, err := fs.ReadFile(fsys, "dir/up.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+
+	// Links out of the sub directory are blocked
+	_, err = fsys.Stat("secret.txt")
+	is.True(errors.Is(err, fs.ErrPermission))
+	_, err = fs.ReadFile(fsys, "secret.txt")
+	is.True(errors.Is(err, fs.ErrPermission))
+	_, err = fs.ReadFile(fsys, "dir/abs.txt")
+	is.True(errors.Is(err, fs.ErrPermission))
+	err = fsys.WriteFile("secret.txt", []byte("overwrite"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	is.Equal(string(tree["secret.txt"].Data), "secret")
+
+	// The links themselves can still be inspected
+	link, err := fsys.Readlink("secret.txt")
+	is.NoErr(err)
+	is.Equal(link, "../secret.txt")
+	info, err = fsys.Lstat("secret.txt")
+	is.NoErr(err)
+	is.Equal(info.Mode()&fs.ModeSymlink, fs.ModeSymlink)
+}
+
+func TestSubConfineSymlinksOS(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0600))
+	is.NoErr(os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	is.NoErr(os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(dir, "sub", "abs.txt")))
+	is.NoErr(os.Symlink("..", filepath.Join(dir, "sub", "parent")))
+	fsys, err := virt.Sub(virt.OS(dir), "sub", virt.ConfineSymlinks())
+	is.NoErr(err)
+	_, err = fs.ReadFile(fsys, "abs.txt")
+	is.True(errors.Is(err, fs.ErrPermission))
+	_, err = fs.ReadFile(fsys, "parent/secret.txt")
+	is.True(errors.Is(err, fs.ErrPermission))
+	err = fsys.WriteFile("parent/escape.txt", []byte("escape"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	_, err = os.Stat(filepath.Join(dir, "escape.txt"))
+	is.True(errors.Is(err, fs.ErrNotExist))
+	_, err = fs.Sub(fsys, "parent")
+	is.True(errors.Is(err, fs.ErrPermission))
+}
@@ -7,13 +7,18 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"time"
 )
 
 func Sync(from fs.FS, toDir string, subpaths ...string) error {
 	return SyncFS(from, OS(toDir), subpaths...)
 }
 
-// Sync files from one filesystem to another at subpath
+// Sync files from one filesystem to another at subpath.
+//
+// Symlinks are copied as links rather than as their targets' data. Links are
+// compared by the link itself, so changing a target doesn't rewrite the links
+// to it, and a retargeted link is removed and recreated.
 func SyncFS(from fs.FS, to FS, subpaths ...string) error {
 	target := path.Join(subpaths...)
 	if target == "" {
@@ -135,7 +140,7 @@ func createOps(from fs.FS, dir string, des []fs.DirEntry) (ops []syncOp, err err
 		}
 		fpath := path.Join(dir, de.Name())
 		if !de.IsDir() {
-			data, err := fs.ReadFile(from, fpath)
+			data, err := readData(from, fpath, de.Type())
 			if err != nil {
 				// Don't error out on files that don't exist
 				if errors.Is(err, fs.ErrNotExist) {
@@ -209,7 +214,7 @@ func updateOps(from fs.FS, to FS, dir string, des []fs.DirEntry) (ops []syncOp,
 		if sourceStamp == targetStamp {
 			continue
 		}
-		data, err := fs.ReadFile(from, fpath)
+		data, err := readData(from, fpath, de.Type())
 		if err != nil {
 			// Don't error out on files that don't exist
 			if errors.Is(err, fs.ErrNotExist) {
@@ -220,18 +225,18 @@ func updateOps(from fs.FS, to FS, dir string, des []fs.DirEntry) (ops []syncOp,
 			return nil, err
 		}
 		// Get the mode
-		fromInfo, err := fs.Stat(from, fpath)
+		fromInfo, err := lstat(from, fpath)
 		if err != nil {
 			return nil, err
 		}
-		toInfo, err := fs.Stat(to, fpath)
+		toInfo, err := lstat(to, fpath)
 		if err != nil {
 			return nil, err
 		}
 		// If the mode has changed, delete the file and create a new one
 		// Because WriteFile with different file modes doesn't actually update
-		// the file mode
-		if fromInfo.Mode() != toInfo.Mode() {
+		// the file mode. Symlinks can't be overwritten either.
+		if fromInfo.Mode() != toInfo.Mode() || fromInfo.Mode()&fs.ModeSymlink != 0 {
 			ops = append(ops, syncOp{deleteType, fpath, nil, 0})
 		}
 		ops = append(ops, syncOp{updateType, fpath, data, fromInfo.Mode()})
@@ -278,19 +283,34 @@ func apply(to FS, ops []syncOp) error {
 	return nil
 }
 
+// readData reads the file's data, or the symlink's target path, so symlinks
+// are copied as links rather than as the data they point to
+func readData(fsys fs.FS, path string, mode fs.FileMode) ([]byte, error) {
+	if mode&fs.ModeSymlink == 0 {
+		return fs.ReadFile(fsys, path)
+	}
+	link, err := readlink(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(link), nil
+}
+
 // Stamp the path, returning "" if the file doesn't exist.
-// Uses the modtime and size to determine if a file has changed.
+// Uses the modtime and size to determine if a file has changed. Symlinks are
+// stamped rather than their targets.
 func stamp(fsys fs.FS, path string) (stamp string, err error) {
-	stat, err := fs.Stat(fsys, path)
+	stat, err := lstat(fsys, path)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return "-1:-1", nil
 		}
 		return "", err
 	}
-	mtime := stat.ModTime().UnixNano()
-	mode := stat.Mode()
-	size := stat.Size()
-	stamp = strconv.Itoa(int(size)) + ":" + mode.String() + ":" + strconv.Itoa(int(mtime))
-	return stamp, nil
+	return stampInfo(stat.Size(), stat.Mode(), stat.ModTime()), nil
+}
+
+func stampInfo(size int64, mode fs.FileMode, modTime time.Time) string {
+	mtime := modTime.UnixNano()
+	return strconv.Itoa(int(size)) + ":" + mode.String() + ":" + strconv.Itoa(int(mtime))
 }
@@ -300,3 +300,63 @@ func TestSyncUpdateExecutable(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(info.Mode(), fs.FileMode(0755))
 }
+
+func TestSyncSymlink(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	tree := virt.Tree{
+		"a.txt":    &virt.File{Data: []byte("a")},
+		"b.txt":    &virt.File{Data: []byte("b")},
+		"link.txt": &virt.File{Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777},
+	}
+	is.NoErr(virt.Sync(tree, dir))
+	link, err := os.Readlink(filepath.Join(dir, "link.txt"))
+	is.NoErr(err)
+	is.Equal(link, "a.txt")
+	// Retarget the symlink
+	tree["link.txt"] = &virt.File{Data: []byte("b.txt"), Mode: fs.ModeSymlink | 0777}
+	is.NoErr(virt.Sync(tree, dir))
+	link, err = os.Readlink(filepath.Join(dir, "link.txt"))
+	is.NoErr(err)
+	is.Equal(link, "b.txt")
+	data, err := os.ReadFile(filepath.Join(dir, "link.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "b")
+	// Writing again replaces the symlink
+	is.NoErr(virt.Write(tree, dir))
+	link, err = os.Readlink(filepath.Join(dir, "link.txt"))
+	is.NoErr(err)
+	is.Equal(link, "b.txt")
+}
+
+func TestSyncSymlinkTree(t *testing.T) {
+	is := is.New(t)
+	// Written files get the same modification time as the originals
+	modTime := time.Date(2021, 8, 4, 14, 56, 0, 0, time.UTC)
+	now := virt.Now
+	defer func() { virt.Now = now }()
+	virt.Now = func() time.Time { return modTime }
+	from := virt.Tree{
+		"a.txt":        &virt.File{Data: []byte("a"), ModTime: modTime},
+		"link.txt":     &virt.File{Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777, ModTime: modTime},
+		"dangling.txt": &virt.File{Data: []byte("missing.txt"), Mode: fs.ModeSymlink | 0777, ModTime: modTime},
+	}
+	to := virt.Tree{}
+	is.NoErr(virt.SyncFS(from, to))
+	// Symlinks are copied as links, even when they dangle
+	link, err := to.Readlink("link.txt")
+	is.NoErr(err)
+	is.Equal(link, "a.txt")
+	link, err = to.Readlink("dangling.txt")
+	is.NoErr(err)
+	is.Equal(link, "missing.txt")
+	// Changing a target doesn't rewrite the links to it, since links are
+	// stamped rather than their targets
+	linkFile := to["link.txt"]
+	from["a.txt"] = &virt.File{Data: []byte("aa"), ModTime: modTime}
+	is.NoErr(virt.SyncFS(from, to))
+	is.Equal(to["link.txt"], linkFile)
+	data, err := fs.ReadFile(to, "link.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "aa")
+}
@@ -0,0 +1,177 @@
+package virt
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// WriteTar writes the filesystem at subpath to w as a tar archive. Modes,
+// modification times, symlinks and empty directories are kept.
+func WriteTar(w io.Writer, fsys fs.FS, subpaths ...string) error {
+	dir := path.Join(subpaths...)
+	if dir == "" {
+		dir = "."
+	}
+	list, err := fromFS(fsys, dir)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	for _, file := range list {
+		if err := writeTarFile(tw, file); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// WriteTarGzip is like WriteTar, but compresses the archive with gzip
+func WriteTarGzip(w io.Writer, fsys fs.FS, subpaths ...string) error {
+	gw := gzip.NewWriter(w)
+	if err := WriteTar(gw, fsys, subpaths...); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeTarFile(tw *tar.Writer, file *File) error {
+	header := &tar.Header{
+		Name:    file.Path,
+		ModTime: archiveTime(file.ModTime),
+		Mode:    int64(file.Mode.Perm()),
+		Format:  tar.FormatPAX,
+	}
+	switch {
+	case file.IsDir():
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+		if header.Mode == 0 {
+			header.Mode = 0755
+		}
+	case file.Mode&fs.ModeSymlink != 0:
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = string(file.Data)
+		if header.Mode == 0 {
+			header.Mode = 0777
+		}
+	default:
+		header.Typeflag = tar.TypeReg
+		header.Size = int64(len(file.Data))
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+	_, err := tw.Write(file.Data)
+	return err
+}
+
+// Zero modification times are written as the Unix epoch, so archives of
+// virtual filesystems are reproducible.
+func archiveTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Unix(0, 0)
+	}
+	return t
+}
+
+// ReadTar reads a tar archive into a Tree. Gzipped archives are detected and
+// decompressed automatically. Entries with absolute paths or ".." elements are
+// rejected.
+func ReadTar(r io.Reader) (Tree, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	r = br
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	tree := Tree{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return tree, nil
+			}
+			return nil, err
+		}
+		fpath, err := archivePath("ReadTar", header.Name)
+		if err != nil {
+			return nil, err
+		} else if fpath == "." {
+			continue
+		}
+		file := &File{
+			Path:    fpath,
+			Mode:    header.FileInfo().Mode(),
+			ModTime: header.ModTime,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeSymlink:
+			file.Data = []byte(header.Linkname)
+		case tar.TypeLink:
+			// Hard links copy the data of an earlier entry, so writing to one
+			// doesn't change the other
+			target, err := archivePath("ReadTar", header.Linkname)
+			if err != nil {
+				return nil, err
+			}
+			original, ok := tree[target]
+			if !ok {
+				return nil, &fs.PathError{Op: "ReadTar", Path: header.Linkname, Err: fs.ErrNotExist}
+			}
+			file.Data = bytes.Clone(original.Data)
+			file.Mode = original.Mode
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			file.Data = data
+		default:
+			// Skip devices, fifos and other special files
+			continue
+		}
+		tree[fpath] = file
+	}
+}
+
+// archivePath cleans a path from an archive and rejects paths that would
+// escape the root.
+func archivePath(op, name string) (string, error) {
+	if strings.HasPrefix(name, "/") || strings.Contains(name, `\`) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	for _, element := range strings.Split(name, "/") {
+		if element == ".." {
+			return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+		}
+	}
+	fpath := path.Clean(name)
+	if !fs.ValidPath(fpath) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return fpath, nil
+}
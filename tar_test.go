@@ -0,0 +1,102 @@
+package virt_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	is := is.New(t)
+	modTime := time.Date(2021, 8, 4, 14, 56, 0, 0, time.UTC)
+	tree := virt.Tree{
+		"a.txt":      &virt.File{Data: []byte("a"), Mode: 0644, ModTime: modTime},
+		"bin/run.sh": &virt.File{Data: []byte("#!/bin/sh"), Mode: 0755, ModTime: modTime},
+		"empty":      &virt.File{Mode: 0700 | fs.ModeDir, ModTime: modTime},
+		"link.txt":   &virt.File{Data: []byte("a.txt"), Mode: 0777 | fs.ModeSymlink, ModTime: modTime},
+		"virtual":    &virt.File{Data: []byte("v")},
+	}
+	for _, write := range []func(buf *bytes.Buffer) error{
+		func(buf *bytes.Buffer) error { return virt.WriteTar(buf, tree) },
+		func(buf *bytes.Buffer) error { return virt.WriteTarGzip(buf, tree) },
+	} {
+		buf := new(bytes.Buffer)
+		is.NoErr(write(buf))
+		actual, err := virt.ReadTar(buf)
+		is.NoErr(err)
+		is.Equal(len(actual), 6)
+		is.Equal(string(actual["a.txt"].Data), "a")
+		is.Equal(actual["a.txt"].Mode, fs.FileMode(0644))
+		is.True(actual["a.txt"].ModTime.Equal(modTime))
+		is.Equal(actual["bin"].Mode, fs.FileMode(0755|fs.ModeDir))
+		is.Equal(actual["bin/run.sh"].Mode, fs.FileMode(0755))
+		is.Equal(actual["empty"].Mode, fs.FileMode(0700|fs.ModeDir))
+		is.Equal(actual["link.txt"].Mode, fs.FileMode(0777|fs.ModeSymlink))
+		is.Equal(string(actual["link.txt"].Data), "a.txt")
+		is.Equal(actual["virtual"].Mode, fs.FileMode(0644))
+		is.True(actual["virtual"].ModTime.Equal(time.Unix(0, 0)))
+	}
+}
+
+func TestTarOS(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(os.MkdirAll(filepath.Join(dir, "sub", "empty"), 0755))
+	is.NoErr(os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0600))
+	buf := new(bytes.Buffer)
+	is.NoErr(virt.WriteTarGzip(buf, virt.OS(dir), "sub"))
+	tree, err := virt.ReadTar(buf)
+	is.NoErr(err)
+	is.Equal(len(tree), 3)
+	is.True(tree["sub"].IsDir())
+	is.True(tree["sub/empty"].IsDir())
+	is.Equal(string(tree["sub/a.txt"].Data), "a")
+	is.Equal(tree["sub/a.txt"].Mode, fs.FileMode(0600))
+}
+
+func TestReadTarUnsafe(t *testing.T) {
+	is := is.New(t)
+	for _, name := range []string{"../a.txt", "/etc/passwd", "a/../../b.txt"} {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		is.NoErr(tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 1}))
+		_, err := tw.Write([]byte("a"))
+		is.NoErr(err)
+		is.NoErr(tw.Close())
+		_, err = virt.ReadTar(buf)
+		is.True(errors.Is(err, fs.ErrInvalid))
+	}
+}
+
+func TestReadTarHardLink(t *testing.T) {
+	is := is.New(t)
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	is.NoErr(tw.WriteHeader(&tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5}))
+	_, err := tw.Write([]byte("hello"))
+	is.NoErr(err)
+	is.NoErr(tw.WriteHeader(&tar.Header{Name: "b.txt", Typeflag: tar.TypeLink, Linkname: "a.txt"}))
+	is.NoErr(tw.Close())
+	tree, err := virt.ReadTar(buf)
+	is.NoErr(err)
+	// Writing to one file doesn't change the other
+	file, err := tree.OpenFile("b.txt", os.O_RDWR, 0)
+	is.NoErr(err)
+	_, err = file.Write([]byte("HE"))
+	is.NoErr(err)
+	is.NoErr(file.Close())
+	data, err := fs.ReadFile(tree, "b.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "HEllo")
+	data, err = fs.ReadFile(tree, "a.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "hello")
+}
@@ -16,74 +16,102 @@ type Tree map[string]*File
 var _ FS = (Tree)(nil)
 
 func (fsys Tree) Open(path string) (fs.File, error) {
-	if !fs.ValidPath(path) {
-		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrInvalid}
-	}
-	file, err := fsys.find(path)
+	file, err := fsys.OpenFile(path, os.O_RDONLY, 0)
 	if err != nil {
-		return nil, &fs.PathError{Op: "open", Path: path, Err: err}
+		return nil, err
 	}
-	return &openFile{file, os.O_RDONLY, 0}, nil
+	return file, nil
 }
 
 func (fsys Tree) Stat(path string) (fs.FileInfo, error) {
-	file, err := fsys.find(path)
-	if err != nil {
-		return nil, err
+	if !fs.ValidPath(path) {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrInvalid}
 	}
 	// Recursively resolve symlinks
-	if file.Mode&fs.ModeSymlink != 0 {
-		target, err := fsys.Stat(string(file.Data))
-		if err != nil {
-			return nil, &fs.PathError{Op: "Stat", Path: path, Err: err}
-		}
-		// Stat returns the original name, but size, mode, and modTime of the target
-		return &fileInfo{
-			path:    path,
-			size:    target.Size(),
-			mode:    target.Mode(),
-			modTime: target.ModTime(),
-		}, nil
+	target, err := followSymlinks("stat", path, fsys.lookup)
+	if err != nil {
+		return nil, err
 	}
-	return file.Info()
+	file, err := fsys.find(target)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	if target == path {
+		return file.Info()
+	}
+	// Stat returns the original name, but size, mode, and modTime of the target
+	return &fileInfo{
+		path:    path,
+		size:    int64(len(file.Data)),
+		mode:    file.Mode,
+		modTime: file.ModTime,
+	}, nil
 }
 
 func (fsys Tree) Lstat(path string) (fs.FileInfo, error) {
+	if !fs.ValidPath(path) {
+		return nil, &fs.PathError{Op: "lstat", Path: path, Err: fs.ErrInvalid}
+	}
 	file, err := fsys.find(path)
 	if err != nil {
-		return nil, err
+		return nil, &fs.PathError{Op: "lstat", Path: path, Err: fs.ErrNotExist}
 	}
 	return file.Info()
 }
 
 func (fsys Tree) Readlink(path string) (string, error) {
+	if !fs.ValidPath(path) {
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
+	}
 	file, err := fsys.find(path)
 	if err != nil {
-		return "", &fs.PathError{Op: "Readlink", Path: path, Err: err}
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrNotExist}
 	}
 	if file.Mode&fs.ModeSymlink == 0 {
-		return "", &fs.PathError{Op: "Readlink", Path: path, Err: fs.ErrInvalid}
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
 	}
 	return string(file.Data), nil
 }
 
+// OpenFile opens a file with the given flags. O_CREATE, O_EXCL, O_TRUNC and
+// O_APPEND are supported. Symlinks are followed like on disk, so opening a link
+// opens its target, and creating through a dangling link creates the target.
 func (fsys Tree) OpenFile(path string, flag int, perm fs.FileMode) (RWFile, error) {
 	if !fs.ValidPath(path) {
-		return nil, &fs.PathError{Op: "Open", Path: path, Err: fs.ErrInvalid}
-	}
-	// TODO: Support more flags in the future
-	if flag != os.O_RDONLY {
-		return nil, &fs.PathError{
-			Op:   "openfile",
-			Path: path,
-			Err:  errors.New("flag not currently supported"),
-		}
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrInvalid}
 	}
-	file, err := fsys.find(path)
+	target, err := followSymlinks("open", path, fsys.lookup)
 	if err != nil {
-		return nil, &fs.PathError{Op: "OpenFile", Path: path, Err: err}
+		return nil, err
 	}
-	return &openFile{file, flag, 0}, nil
+	if file, err := fsys.find(target); err == nil {
+		f, err := openTarget("open", path, file, flag)
+		if err != nil {
+			return nil, err
+		}
+		if flag&os.O_TRUNC != 0 {
+			fsys.changed(target)
+		}
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return &treeFile{f, fsys, target, false}, nil
+		}
+		return f, nil
+	} else if flag&os.O_CREATE == 0 {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	if err := checkParents("open", target, fsys.lookup); err != nil {
+		return nil, err
+	}
+	file := &File{target, nil, perm, Now(), nil}
+	fsys[target] = file
+	fsys.changed(target)
+	return &treeFile{&openFile{file, flag, 0}, fsys, target, false}, nil
+}
+
+// lookup a file that's in the tree. Synthesized directories aren't returned.
+func (fsys Tree) lookup(path string) (*File, bool) {
+	file, ok := fsys[path]
+	return file, ok
 }
 
 // Find a file in the Tree filesystem. subdirectories are synthesized if they
@@ -164,21 +192,35 @@ func (t Tree) MkdirAll(path string, perm fs.FileMode) error {
 	} else if path == "." {
 		return nil
 	}
+	if err := checkParents("MkdirAll", path, t.lookup); err != nil {
+		return err
+	}
 	// Don't create a directory unless we have to
-	if _, err := fs.Stat(t, path); nil == err {
-		return nil
+	if info, err := fs.Stat(t, path); nil == err {
+		if info.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "MkdirAll", Path: path, Err: errNotADirectory}
 	}
 	t[path] = &File{path, nil, perm | fs.ModeDir, Now(), nil}
+	t.changed(path)
 	return nil
 }
 
-// WriteFile writes a file
-// TODO: WriteFile should fail if path.Dir(name) doesn't exist
+// WriteFile writes a file. Parent directories are synthesized, so they don't
+// need to exist beforehand.
 func (t Tree) WriteFile(path string, data []byte, perm fs.FileMode) error {
 	if !fs.ValidPath(path) {
 		return &fs.PathError{Op: "WriteFile", Path: path, Err: fs.ErrInvalid}
 	}
+	if err := checkParents("WriteFile", path, t.lookup); err != nil {
+		return err
+	}
+	if info, err := t.Lstat(path); err == nil && info.IsDir() {
+		return &fs.PathError{Op: "WriteFile", Path: path, Err: errIsDirectory}
+	}
 	t[path] = &File{path, data, perm, Now(), nil}
+	t.changed(path)
 	return nil
 }
 
@@ -187,7 +229,8 @@ func (t Tree) RemoveAll(path string) error {
 	if !fs.ValidPath(path) {
 		return &fs.PathError{Op: "RemoveAll", Path: path, Err: fs.ErrInvalid}
 	}
-	stat, err := fs.Stat(t, path)
+	// Symlinks are removed, not their targets
+	stat, err := t.Lstat(path)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return nil
@@ -196,6 +239,7 @@ func (t Tree) RemoveAll(path string) error {
 	}
 	// Delete the path
 	delete(t, path)
+	defer t.changed(path)
 	// Only delete the file
 	if !stat.IsDir() {
 		return nil
@@ -313,3 +313,16 @@ func TestTreeReadDirInvalid(t *testing.T) {
 	is.Equal(err.Error(), "open a/b.txt: not a directory")
 	is.Equal(len(des), 0)
 }
+
+func TestTreeTestFS(t *testing.T) {
+	is := is.New(t)
+	fsys := virt.Tree{
+		"a.txt":         &virt.File{Data: []byte("a"), Mode: 0600},
+		"bin":           &virt.File{Mode: fs.ModeDir | 0700},
+		"bin/run.sh":    &virt.File{Data: []byte("#!/bin/sh"), Mode: 0755},
+		"empty":         &virt.File{Mode: fs.ModeDir | 0755},
+		"link.txt":      &virt.File{Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777},
+		"nested/b/c.go": &virt.File{Data: []byte("package b")},
+	}
+	is.NoErr(fstest.TestFS(fsys, "a.txt", "bin/run.sh", "empty", "link.txt", "nested/b/c.go"))
+}
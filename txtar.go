@@ -0,0 +1,223 @@
+package virt
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// MarshalTxtar renders the filesystem at subpath as a txtar archive, the format
+// used by Go's cmd/go tests. Files are written in lexical order. Permissions
+// that differ from 0644 for files and 0755 for directories, symlinks and empty
+// directories are written to the archive comment as headers like:
+//
+//	-rwxr-xr-x bin/run.sh
+//	drwxr-xr-x empty
+//	Lrwxrwxrwx link.txt -> a.txt
+//
+// Like txtar, a trailing newline is added to files that don't end with one.
+func MarshalTxtar(fsys fs.FS, subpaths ...string) ([]byte, error) {
+	dir := path.Join(subpaths...)
+	if dir == "" {
+		dir = "."
+	}
+	list, err := fromFS(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	headers := new(bytes.Buffer)
+	files := new(bytes.Buffer)
+	for i, file := range list {
+		switch {
+		case file.Mode&fs.ModeSymlink != 0:
+			fmt.Fprintf(headers, "%s %s -> %s\n", file.Mode, file.Path, file.Data)
+		case file.IsDir():
+			empty := i == len(list)-1 || !strings.HasPrefix(list[i+1].Path, file.Path+"/")
+			if empty || !isDefaultPerm(file.Mode, 0755) {
+				fmt.Fprintf(headers, "%s %s\n", dirMode(file.Mode), file.Path)
+			}
+		default:
+			if !isDefaultPerm(file.Mode, 0644) {
+				fmt.Fprintf(headers, "%s %s\n", file.Mode, file.Path)
+			}
+			if err := writeTxtarFile(files, file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	headers.Write(files.Bytes())
+	return headers.Bytes(), nil
+}
+
+// UnmarshalTxtar parses a txtar archive into a Tree. Headers in the archive
+// comment, as written by MarshalTxtar, set modes and create symlinks and
+// directories. Other comment lines are ignored.
+func UnmarshalTxtar(data []byte) (Tree, error) {
+	list, err := UnmarshalTxtarList(data)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(Tree, len(list))
+	for _, file := range list {
+		tree[file.Path] = file
+	}
+	return tree, nil
+}
+
+// UnmarshalTxtarList parses a txtar archive into a List sorted by path
+func UnmarshalTxtarList(data []byte) (List, error) {
+	comment, sections := parseTxtar(data)
+	files := map[string]*File{}
+	for _, section := range sections {
+		if !fs.ValidPath(section.Path) {
+			return nil, &fs.PathError{Op: "UnmarshalTxtar", Path: section.Path, Err: fs.ErrInvalid}
+		}
+		section.Mode = 0644
+		files[section.Path] = section
+	}
+	for _, line := range strings.Split(string(comment), "\n") {
+		header, ok := parseTxtarHeader(line)
+		if !ok {
+			continue
+		}
+		if !fs.ValidPath(header.Path) {
+			return nil, &fs.PathError{Op: "UnmarshalTxtar", Path: header.Path, Err: fs.ErrInvalid}
+		}
+		file, ok := files[header.Path]
+		if !ok || header.Mode.Type() != 0 {
+			files[header.Path] = header
+			continue
+		}
+		// Update the mode of an existing file
+		file.Mode = header.Mode
+	}
+	list := make(List, 0, len(files))
+	for _, file := range files {
+		list = append(list, file)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	return list, nil
+}
+
+// Files without permissions are treated as having the default permissions
+func isDefaultPerm(mode, perm fs.FileMode) bool {
+	return mode.Perm() == 0 || mode.Perm() == perm
+}
+
+// dirMode fills in default permissions for directories without them
+func dirMode(mode fs.FileMode) fs.FileMode {
+	if mode.Perm() == 0 {
+		return mode | 0755
+	}
+	return mode
+}
+
+func writeTxtarFile(w *bytes.Buffer, file *File) error {
+	for _, line := range strings.Split(string(file.Data), "\n") {
+		if _, ok := txtarMarker(line); ok {
+			return &fs.PathError{Op: "MarshalTxtar", Path: file.Path, Err: fmt.Errorf("virt: file contains a txtar file marker %q", line)}
+		}
+	}
+	fmt.Fprintf(w, "-- %s --\n", file.Path)
+	w.Write(file.Data)
+	if len(file.Data) > 0 && file.Data[len(file.Data)-1] != '\n' {
+		w.WriteByte('\n')
+	}
+	return nil
+}
+
+// parseTxtar splits the archive into the comment and its files
+func parseTxtar(data []byte) (comment []byte, files []*File) {
+	var file *File
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i+1], data[i+1:]
+		} else {
+			data = nil
+		}
+		if name, ok := txtarMarker(strings.TrimSuffix(string(line), "\n")); ok {
+			file = &File{Path: name, Data: []byte{}}
+			files = append(files, file)
+			continue
+		}
+		if file == nil {
+			comment = append(comment, line...)
+			continue
+		}
+		file.Data = append(file.Data, line...)
+	}
+	return comment, files
+}
+
+// txtarMarker returns the file name if the line is a "-- name --" marker
+func txtarMarker(line string) (name string, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	if !strings.HasPrefix(line, "-- ") || !strings.HasSuffix(line, " --") || len(line) < 6 {
+		return "", false
+	}
+	name = strings.TrimSpace(line[3 : len(line)-3])
+	if name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// parseTxtarHeader parses a header line like "-rwxr-xr-x bin/run.sh" or
+// "Lrwxrwxrwx link.txt -> a.txt"
+func parseTxtarHeader(line string) (*File, bool) {
+	modeString, rest, ok := strings.Cut(strings.TrimSpace(line), " ")
+	if !ok {
+		return nil, false
+	}
+	mode, ok := parseFileMode(modeString)
+	if !ok {
+		return nil, false
+	}
+	file := &File{Path: strings.TrimSpace(rest), Mode: mode}
+	if mode&fs.ModeSymlink != 0 {
+		from, to, ok := strings.Cut(rest, " -> ")
+		if !ok {
+			return nil, false
+		}
+		file.Path = strings.TrimSpace(from)
+		file.Data = []byte(strings.TrimSpace(to))
+	}
+	if file.Path == "" {
+		return nil, false
+	}
+	return file, true
+}
+
+// parseFileMode parses the output of fs.FileMode.String() for regular files,
+// directories and symlinks.
+func parseFileMode(s string) (mode fs.FileMode, ok bool) {
+	if len(s) != 10 {
+		return 0, false
+	}
+	switch s[0] {
+	case '-':
+	case 'd':
+		mode |= fs.ModeDir
+	case 'L':
+		mode |= fs.ModeSymlink
+	default:
+		return 0, false
+	}
+	const rwx = "rwxrwxrwx"
+	for i, c := range s[1:] {
+		switch c {
+		case '-':
+		case rune(rwx[i]):
+			mode |= 1 << uint(8-i)
+		default:
+			return 0, false
+		}
+	}
+	return mode, true
+}
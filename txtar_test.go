@@ -0,0 +1,105 @@
+package virt_test
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestMarshalTxtar(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"b.txt":      &virt.File{Data: []byte("b\n"), Mode: 0644},
+		"a/a.txt":    &virt.File{Data: []byte("a"), Mode: 0644},
+		"bin/run.sh": &virt.File{Data: []byte("#!/bin/sh\n"), Mode: 0755},
+		"empty":      &virt.File{Mode: 0700 | fs.ModeDir},
+		"link.txt":   &virt.File{Data: []byte("b.txt"), Mode: 0777 | fs.ModeSymlink},
+		"virtual":    &virt.File{Data: []byte("v\n")},
+	}
+	data, err := virt.MarshalTxtar(tree)
+	is.NoErr(err)
+	is.Equal(string(data), `-rwxr-xr-x bin/run.sh
+drwx------ empty
+Lrwxrwxrwx link.txt -> b.txt
+-- a/a.txt --
+a
+-- b.txt --
+b
+-- bin/run.sh --
+#!/bin/sh
+-- virtual --
+v
+`)
+	// Marshalling is deterministic
+	again, err := virt.MarshalTxtar(tree)
+	is.NoErr(err)
+	is.Equal(string(again), string(data))
+}
+
+func TestMarshalTxtarMarker(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"a.txt": &virt.File{Data: []byte("-- b.txt --\n")},
+	}
+	_, err := virt.MarshalTxtar(tree)
+	is.True(err != nil)
+}
+
+func TestUnmarshalTxtar(t *testing.T) {
+	is := is.New(t)
+	tree, err := virt.UnmarshalTxtar([]byte(`This is a comment.
+-rwxr-xr-x bin/run.sh
+drwx------ empty
+Lrwxrwxrwx link.txt -> b.txt
+-- a/a.txt --
+a
+-- b.txt --
+b
+-- bin/run.sh --
+#!/bin/sh
+-- empty.txt --
+`))
+	is.NoErr(err)
+	is.Equal(len(tree), 6)
+	is.Equal(string(tree["a/a.txt"].Data), "a\n")
+	is.Equal(tree["a/a.txt"].Mode, fs.FileMode(0644))
+	is.Equal(string(tree["b.txt"].Data), "b\n")
+	is.Equal(tree["bin/run.sh"].Mode, fs.FileMode(0755))
+	is.Equal(tree["empty"].Mode, fs.FileMode(0700|fs.ModeDir))
+	is.Equal(tree["link.txt"].Mode, fs.FileMode(0777|fs.ModeSymlink))
+	is.Equal(len(tree["empty.txt"].Data), 0)
+	link, err := tree.Readlink("link.txt")
+	is.NoErr(err)
+	is.Equal(link, "b.txt")
+	des, err := fs.ReadDir(tree, "empty")
+	is.NoErr(err)
+	is.Equal(len(des), 0)
+
+	// Round trip
+	data, err := virt.MarshalTxtar(tree)
+	is.NoErr(err)
+	is.Equal(string(data), `-rwxr-xr-x bin/run.sh
+drwx------ empty
+Lrwxrwxrwx link.txt -> b.txt
+-- a/a.txt --
+a
+-- b.txt --
+b
+-- bin/run.sh --
+#!/bin/sh
+-- empty.txt --
+`)
+}
+
+func TestUnmarshalTxtarList(t *testing.T) {
+	is := is.New(t)
+	list, err := virt.UnmarshalTxtarList([]byte("-- b.txt --\nb\n-- a.txt --\na\n"))
+	is.NoErr(err)
+	is.Equal(len(list), 2)
+	is.Equal(list[0].Path, "a.txt")
+	is.Equal(list[1].Path, "b.txt")
+	_, err = virt.UnmarshalTxtarList([]byte("-- ../a.txt --\na\n"))
+	is.True(err != nil)
+}
@@ -0,0 +1,15 @@
+module github.com/matthewmueller/virt/virtdav
+
+go 1.23.0
+
+require (
+	github.com/matryer/is v1.4.1
+	github.com/matthewmueller/virt v0.0.15-0.20261019093942-3cc3ba63be38
+	golang.org/x/net v0.40.0
+)
+
+require github.com/xlab/treeprint v1.2.0 // indirect
+
+// Develop against the virt package in the parent directory. Replace directives
+// only apply within this repository, so importers use the required version.
+replace github.com/matthewmueller/virt => ../
@@ -0,0 +1,233 @@
+// Package virtdav serves virtual filesystems over WebDAV, so they can be
+// mounted from a desktop.
+package virtdav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/matthewmueller/virt"
+	"golang.org/x/net/webdav"
+)
+
+// Handler serves the filesystem over WebDAV with in-memory locks
+func Handler(fsys virt.FS) http.Handler {
+	return &webdav.Handler{
+		FileSystem: FileSystem(fsys),
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+// FileSystem adapts fsys to a WebDAV filesystem. Operations are serialized, so
+// filesystems that aren't safe for concurrent use, like virt.Tree, can be
+// served.
+//
+// Since virt.FS doesn't support renaming, Rename copies the files, then
+// removes the originals. If the copy fails, the partial copy is removed.
+func FileSystem(fsys virt.FS) webdav.FileSystem {
+	return &fileSystem{fs: fsys}
+}
+
+type fileSystem struct {
+	mu sync.Mutex
+	fs virt.FS
+}
+
+var _ webdav.FileSystem = (*fileSystem)(nil)
+
+// Flags that modify the filesystem
+const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_CREATE | os.O_EXCL | os.O_TRUNC | os.O_APPEND
+
+// clean converts a slash-rooted WebDAV name into a virt path
+func clean(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (d *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name = clean(name)
+	if _, err := d.fs.Lstat(name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	// Unlike MkdirAll, the parent must already exist
+	parent, err := d.fs.Stat(path.Dir(name))
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrNotExist}
+	} else if !parent.IsDir() {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: errNotADirectory}
+	}
+	return d.fs.MkdirAll(name, perm)
+}
+
+func (d *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name = clean(name)
+	if flag&writeFlags == 0 {
+		file, err := d.fs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &davFile{file, &d.mu, name}, nil
+	}
+	file, err := d.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &davFile{file, &d.mu, name}, nil
+}
+
+func (d *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name = clean(name)
+	// Match os.RemoveAll, which refuses to remove the root
+	if name == "." {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+	return d.fs.RemoveAll(name)
+}
+
+func (d *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	oldName, newName = clean(oldName), clean(newName)
+	if oldName == "." || newName == "." {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrInvalid}
+	}
+	if newName == oldName || strings.HasPrefix(newName, oldName+"/") {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrInvalid}
+	}
+	if _, err := d.fs.Lstat(oldName); err != nil {
+		return err
+	}
+	_, err := d.fs.Lstat(newName)
+	existed := err == nil
+	if err := d.copy(oldName, newName); err != nil {
+		// Don't leave a partial copy behind
+		if !existed {
+			d.fs.RemoveAll(newName)
+		}
+		return err
+	}
+	return d.fs.RemoveAll(oldName)
+}
+
+// copy the path and everything within it to a new path
+func (d *fileSystem) copy(oldName, newName string) error {
+	return fs.WalkDir(d.fs, oldName, func(fpath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := path.Join(newName, strings.TrimPrefix(fpath, oldName))
+		info, err := d.fs.Lstat(fpath)
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		switch {
+		case mode.IsDir():
+			return d.fs.MkdirAll(target, mode)
+		case mode&fs.ModeSymlink != 0:
+			link, err := d.fs.Readlink(fpath)
+			if err != nil {
+				return err
+			}
+			return d.fs.WriteFile(target, []byte(link), mode)
+		default:
+			data, err := fs.ReadFile(d.fs, fpath)
+			if err != nil {
+				return err
+			}
+			return d.fs.WriteFile(target, data, mode)
+		}
+	})
+}
+
+func (d *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.fs.Stat(clean(name))
+}
+
+var errNotADirectory = errors.New("not a directory")
+
+// davFile adapts an fs.File to a WebDAV file
+type davFile struct {
+	file fs.File
+	mu   *sync.Mutex
+	name string
+}
+
+var _ webdav.File = (*davFile)(nil)
+
+func (f *davFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Read(p)
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	seeker, ok := f.file.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errors.ErrUnsupported}
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// Readdir returns the file info for the entries in the directory. Like
+// os.File.Readdir, a count of zero or less returns all of the entries.
+func (f *davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dir, ok := f.file.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotADirectory}
+	}
+	des, err := dir.ReadDir(count)
+	infos := make([]fs.FileInfo, 0, len(des))
+	for _, de := range des {
+		info, err := de.Info()
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+func (f *davFile) Stat() (fs.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Stat()
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writer, ok := f.file.(io.Writer)
+	if !ok {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	return writer.Write(p)
+}
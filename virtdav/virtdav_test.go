@@ -0,0 +1,140 @@
+package virtdav_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+	"github.com/matthewmueller/virt/virtdav"
+	"github.com/matthewmueller/virt/virttest"
+)
+
+func request(t testing.TB, server *httptest.Server, method, target, body string, headers ...string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(data)
+}
+
+func TestHandler(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{
+		"a.txt": &virt.File{Data: []byte("a"), Mode: 0644},
+	}
+	server := httptest.NewServer(virtdav.Handler(tree))
+	defer server.Close()
+	res, body := request(t, server, "GET", "/a.txt", "")
+	is.Equal(res.StatusCode, 200)
+	is.Equal(body, "a")
+	res, _ = request(t, server, "MKCOL", "/docs", "")
+	is.Equal(res.StatusCode, 201)
+	res, _ = request(t, server, "PUT", "/docs/b.txt", "hello")
+	is.Equal(res.StatusCode, 201)
+	is.Equal(string(tree["docs/b.txt"].Data), "hello")
+	res, body = request(t, server, "PROPFIND", "/docs/", "", "Depth", "1")
+	is.Equal(res.StatusCode, 207)
+	is.True(strings.Contains(body, "<D:href>/docs/b.txt</D:href>"))
+	res, _ = request(t, server, "MOVE", "/docs/b.txt", "", "Destination", server.URL+"/c.txt")
+	is.Equal(res.StatusCode, 201)
+	is.Equal(string(tree["c.txt"].Data), "hello")
+	_, ok := tree["docs/b.txt"]
+	is.True(!ok)
+	res, _ = request(t, server, "DELETE", "/docs", "")
+	is.Equal(res.StatusCode, 204)
+	_, ok = tree["docs"]
+	is.True(!ok)
+	res, _ = request(t, server, "GET", "/docs/b.txt", "")
+	is.Equal(res.StatusCode, 404)
+}
+
+func TestFileSystem(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	fsys := virtdav.FileSystem(virt.Tree{})
+	// Mkdir requires the parent to exist
+	err := fsys.Mkdir(ctx, "/a/b", 0755)
+	is.True(errors.Is(err, fs.ErrNotExist))
+	is.NoErr(fsys.Mkdir(ctx, "/a", 0755))
+	err = fsys.Mkdir(ctx, "/a", 0755)
+	is.True(errors.Is(err, fs.ErrExist))
+	// Write a file
+	file, err := fsys.OpenFile(ctx, "/a/b.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	is.NoErr(err)
+	_, err = file.Write([]byte("b"))
+	is.NoErr(err)
+	is.NoErr(file.Close())
+	// Read the directory
+	dir, err := fsys.OpenFile(ctx, "/a", os.O_RDONLY, 0)
+	is.NoErr(err)
+	infos, err := dir.Readdir(0)
+	is.NoErr(err)
+	is.Equal(len(infos), 1)
+	is.Equal(infos[0].Name(), "b.txt")
+	is.NoErr(dir.Close())
+	// Rename the directory
+	is.NoErr(fsys.Rename(ctx, "/a", "/c"))
+	_, err = fsys.Stat(ctx, "/a/b.txt")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	info, err := fsys.Stat(ctx, "/c/b.txt")
+	is.NoErr(err)
+	is.Equal(info.Size(), int64(1))
+	err = fsys.Rename(ctx, "/c", "/c/d")
+	is.True(errors.Is(err, fs.ErrInvalid))
+	// Files opened for reading can't be written
+	file, err = fsys.OpenFile(ctx, "/c/b.txt", os.O_RDONLY, 0)
+	is.NoErr(err)
+	_, err = file.Write([]byte("c"))
+	is.True(err != nil)
+	is.NoErr(file.Close())
+	is.NoErr(fsys.RemoveAll(ctx, "/c"))
+	_, err = fsys.Stat(ctx, "/c")
+	is.True(errors.Is(err, fs.ErrNotExist))
+}
+
+func TestRenameFailure(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	tree := virt.Tree{
+		"a/1.txt": &virt.File{Data: []byte("1")},
+		"a/2.txt": &virt.File{Data: []byte("2")},
+	}
+	// Fail the second file that's copied
+	fsys := virtdav.FileSystem(virttest.Fault(tree, virttest.Rule{
+		Op:  "WriteFile",
+		Nth: 2,
+		Err: virttest.ErrNoSpace,
+	}))
+	err := fsys.Rename(ctx, "/a", "/b")
+	is.True(errors.Is(err, virttest.ErrNoSpace))
+	// The partial copy is removed and the originals are kept
+	_, err = fsys.Stat(ctx, "/b")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	data, err := fs.ReadFile(tree, "a/1.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "1")
+	data, err = fs.ReadFile(tree, "a/2.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "2")
+}
@@ -0,0 +1,377 @@
+package virttest
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/matthewmueller/virt"
+)
+
+// Difference is a known way a filesystem behaves differently than the OS
+type Difference uint8
+
+const (
+	// ImplicitDirs means files can be created in directories that don't exist,
+	// rather than failing with fs.ErrNotExist.
+	ImplicitDirs Difference = iota + 1
+	// NoCreate means OpenFile can't create files, so O_CREATE fails with
+	// fs.ErrNotExist for files that don't exist yet. Files are created with
+	// WriteFile instead.
+	NoCreate
+)
+
+func (d Difference) String() string {
+	switch d {
+	case ImplicitDirs:
+		return "ImplicitDirs"
+	case NoCreate:
+		return "NoCreate"
+	default:
+		return ""
+	}
+}
+
+// TestFS runs a conformance suite for writing to a filesystem. Unlike
+// fstest.TestFS, it checks OpenFile flags, WriteFile, MkdirAll, RemoveAll,
+// Lstat, Readlink, symlink resolution, and the errors returned for missing,
+// existing and invalid paths.
+//
+// The OS is the reference, so any behavior that differs from it fails the
+// test, unless the difference is listed as known. Known differences are logged
+// instead. The newFS function is called for every check and must return an
+// empty filesystem.
+func TestFS(t *testing.T, newFS func(t *testing.T) virt.FS, known ...Difference) {
+	c := &conformance{newFS, map[Difference]bool{}}
+	for _, d := range known {
+		c.known[d] = true
+	}
+	t.Run("InvalidPath", c.testInvalidPath)
+	t.Run("NotExist", c.testNotExist)
+	t.Run("WriteFile", c.testWriteFile)
+	t.Run("WriteFileParent", c.testWriteFileParent)
+	t.Run("MkdirAll", c.testMkdirAll)
+	t.Run("RemoveAll", c.testRemoveAll)
+	t.Run("Symlink", c.testSymlink)
+	t.Run("OpenFile", c.testOpenFile)
+	t.Run("OpenFileError", c.testOpenFileError)
+}
+
+type conformance struct {
+	newFS func(t *testing.T) virt.FS
+	known map[Difference]bool
+}
+
+// differs fails the test unless the difference is known
+func (c *conformance) differs(t *testing.T, d Difference, format string, args ...any) {
+	t.Helper()
+	if c.known[d] {
+		t.Logf("known difference %s: "+format, append([]any{d}, args...)...)
+		return
+	}
+	t.Errorf(format, args...)
+}
+
+// checkError checks that err is a *fs.PathError that matches target
+func checkError(t *testing.T, op string, err, target error) {
+	t.Helper()
+	if err == nil {
+		t.Errorf("%s: expected %v, got nil", op, target)
+		return
+	}
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		t.Errorf("%s: expected a *fs.PathError, got %T: %v", op, err, err)
+	}
+	if target != nil && !errors.Is(err, target) {
+		t.Errorf("%s: expected %v, got %v", op, target, err)
+	}
+}
+
+func noErr(t *testing.T, op string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", op, err)
+	}
+}
+
+func readFile(t *testing.T, fsys fs.FS, name string) string {
+	t.Helper()
+	data, err := fs.ReadFile(fsys, name)
+	noErr(t, "ReadFile "+name, err)
+	return string(data)
+}
+
+func (c *conformance) testInvalidPath(t *testing.T) {
+	fsys := c.newFS(t)
+	for _, name := range []string{"", "/a", "../a", "a/../b", "a//b", "a/", "./a"} {
+		_, err := fsys.Open(name)
+		checkError(t, "Open "+name, err, fs.ErrInvalid)
+		_, err = fsys.Stat(name)
+		checkError(t, "Stat "+name, err, fs.ErrInvalid)
+		_, err = fsys.Lstat(name)
+		checkError(t, "Lstat "+name, err, fs.ErrInvalid)
+		_, err = fsys.Readlink(name)
+		checkError(t, "Readlink "+name, err, fs.ErrInvalid)
+		_, err = fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0644)
+		checkError(t, "OpenFile "+name, err, fs.ErrInvalid)
+		err = fsys.WriteFile(name, []byte("a"), 0644)
+		checkError(t, "WriteFile "+name, err, fs.ErrInvalid)
+		err = fsys.MkdirAll(name, 0755)
+		checkError(t, "MkdirAll "+name, err, fs.ErrInvalid)
+		err = fsys.RemoveAll(name)
+		checkError(t, "RemoveAll "+name, err, fs.ErrInvalid)
+	}
+}
+
+func (c *conformance) testNotExist(t *testing.T) {
+	fsys := c.newFS(t)
+	_, err := fsys.Open("missing.txt")
+	checkError(t, "Open", err, fs.ErrNotExist)
+	_, err = fsys.Stat("missing.txt")
+	checkError(t, "Stat", err, fs.ErrNotExist)
+	_, err = fsys.Lstat("missing.txt")
+	checkError(t, "Lstat", err, fs.ErrNotExist)
+	_, err = fsys.Readlink("missing.txt")
+	checkError(t, "Readlink", err, fs.ErrNotExist)
+	_, err = fsys.OpenFile("missing.txt", os.O_RDONLY, 0)
+	checkError(t, "OpenFile O_RDONLY", err, fs.ErrNotExist)
+	_, err = fsys.OpenFile("missing.txt", os.O_WRONLY, 0)
+	checkError(t, "OpenFile O_WRONLY", err, fs.ErrNotExist)
+	_, err = fsys.Stat("missing/a.txt")
+	checkError(t, "Stat in a missing directory", err, fs.ErrNotExist)
+	// Removing a path that doesn't exist isn't an error
+	noErr(t, "RemoveAll", fsys.RemoveAll("missing.txt"))
+}
+
+func (c *conformance) testWriteFile(t *testing.T) {
+	fsys := c.newFS(t)
+	noErr(t, "WriteFile", fsys.WriteFile("a.txt", []byte("hello"), 0644))
+	if data := readFile(t, fsys, "a.txt"); data != "hello" {
+		t.Errorf("ReadFile: expected %q, got %q", "hello", data)
+	}
+	for _, stat := range []func(string) (fs.FileInfo, error){fsys.Stat, fsys.Lstat} {
+		info, err := stat("a.txt")
+		noErr(t, "Stat", err)
+		if info.Name() != "a.txt" {
+			t.Errorf("Stat: expected name %q, got %q", "a.txt", info.Name())
+		}
+		if info.Size() != 5 {
+			t.Errorf("Stat: expected size 5, got %d", info.Size())
+		}
+		if info.Mode() != 0644 {
+			t.Errorf("Stat: expected mode %s, got %s", fs.FileMode(0644), info.Mode())
+		}
+	}
+	_, err := fsys.Readlink("a.txt")
+	checkError(t, "Readlink a file", err, fs.ErrInvalid)
+	// Overwrite the file
+	noErr(t, "WriteFile", fsys.WriteFile("a.txt", []byte("bye"), 0644))
+	if data := readFile(t, fsys, "a.txt"); data != "bye" {
+		t.Errorf("ReadFile: expected %q, got %q", "bye", data)
+	}
+	// Directories can't be overwritten by files
+	noErr(t, "MkdirAll", fsys.MkdirAll("dir", 0755))
+	checkError(t, "WriteFile over a directory", fsys.WriteFile("dir", []byte("a"), 0644), nil)
+	// Files can't be written within files
+	checkError(t, "WriteFile within a file", fsys.WriteFile("a.txt/b.txt", []byte("b"), 0644), nil)
+}
+
+func (c *conformance) testWriteFileParent(t *testing.T) {
+	fsys := c.newFS(t)
+	err := fsys.WriteFile("missing/a.txt", []byte("a"), 0644)
+	if err == nil {
+		c.differs(t, ImplicitDirs, "WriteFile in a missing directory: expected fs.ErrNotExist, got nil")
+		return
+	}
+	checkError(t, "WriteFile in a missing directory", err, fs.ErrNotExist)
+}
+
+func (c *conformance) testMkdirAll(t *testing.T) {
+	fsys := c.newFS(t)
+	noErr(t, "MkdirAll .", fsys.MkdirAll(".", 0755))
+	noErr(t, "MkdirAll", fsys.MkdirAll("a/b/c", 0755))
+	for _, dir := range []string{"a", "a/b", "a/b/c"} {
+		info, err := fsys.Stat(dir)
+		noErr(t, "Stat "+dir, err)
+		if !info.IsDir() {
+			t.Errorf("Stat %s: expected a directory, got %s", dir, info.Mode())
+		}
+	}
+	// Creating a directory that exists isn't an error
+	noErr(t, "MkdirAll again", fsys.MkdirAll("a/b", 0755))
+	noErr(t, "WriteFile", fsys.WriteFile("a/b/c/d.txt", []byte("d"), 0644))
+	des, err := fs.ReadDir(fsys, "a/b")
+	noErr(t, "ReadDir", err)
+	if len(des) != 1 || des[0].Name() != "c" || !des[0].IsDir() {
+		t.Errorf("ReadDir: expected a single directory c, got %v", des)
+	}
+	// Directories can't replace files or be created within files
+	noErr(t, "WriteFile", fsys.WriteFile("file.txt", []byte("a"), 0644))
+	checkError(t, "MkdirAll over a file", fsys.MkdirAll("file.txt", 0755), nil)
+	checkError(t, "MkdirAll within a file", fsys.MkdirAll("file.txt/sub", 0755), nil)
+}
+
+func (c *conformance) testRemoveAll(t *testing.T) {
+	fsys := c.newFS(t)
+	noErr(t, "MkdirAll", fsys.MkdirAll("a/b", 0755))
+	noErr(t, "WriteFile", fsys.WriteFile("a/b/c.txt", []byte("c"), 0644))
+	noErr(t, "WriteFile", fsys.WriteFile("a/d.txt", []byte("d"), 0644))
+	noErr(t, "WriteFile", fsys.WriteFile("a/b.txt", []byte("b"), 0644))
+	noErr(t, "RemoveAll", fsys.RemoveAll("a/b"))
+	for _, name := range []string{"a/b", "a/b/c.txt"} {
+		_, err := fsys.Lstat(name)
+		checkError(t, "Lstat removed "+name, err, fs.ErrNotExist)
+	}
+	// Siblings that share a prefix are kept
+	for _, name := range []string{"a/d.txt", "a/b.txt"} {
+		_, err := fsys.Lstat(name)
+		noErr(t, "Lstat kept "+name, err)
+	}
+	noErr(t, "RemoveAll a file", fsys.RemoveAll("a/d.txt"))
+	_, err := fsys.Lstat("a/d.txt")
+	checkError(t, "Lstat removed a/d.txt", err, fs.ErrNotExist)
+	noErr(t, "RemoveAll again", fsys.RemoveAll("a/d.txt"))
+}
+
+func (c *conformance) testSymlink(t *testing.T) {
+	fsys := c.newFS(t)
+	noErr(t, "WriteFile", fsys.WriteFile("target.txt", []byte("hello"), 0644))
+	noErr(t, "Symlink", fsys.WriteFile("link.txt", []byte("target.txt"), fs.ModeSymlink|0777))
+	info, err := fsys.Lstat("link.txt")
+	noErr(t, "Lstat", err)
+	if info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Lstat: expected a symlink, got %s", info.Mode())
+	}
+	link, err := fsys.Readlink("link.txt")
+	noErr(t, "Readlink", err)
+	if link != "target.txt" {
+		t.Errorf("Readlink: expected %q, got %q", "target.txt", link)
+	}
+	// Stat follows the symlink, but keeps the name
+	info, err = fsys.Stat("link.txt")
+	noErr(t, "Stat", err)
+	if info.Name() != "link.txt" {
+		t.Errorf("Stat: expected name %q, got %q", "link.txt", info.Name())
+	}
+	if info.Mode()&fs.ModeSymlink != 0 || info.Size() != 5 {
+		t.Errorf("Stat: expected the target, got mode %s and size %d", info.Mode(), info.Size())
+	}
+	if data := readFile(t, fsys, "link.txt"); data != "hello" {
+		t.Errorf("ReadFile through a symlink: expected %q, got %q", "hello", data)
+	}
+	// Targets are relative to the directory containing the link
+	noErr(t, "MkdirAll", fsys.MkdirAll("dir", 0755))
+	noErr(t, "Symlink", fsys.WriteFile("dir/up.txt", []byte("../target.txt"), fs.ModeSymlink|0777))
+	info, err = fsys.Stat("dir/up.txt")
+	noErr(t, "Stat a relative symlink", err)
+	if info.Size() != 5 {
+		t.Errorf("Stat a relative symlink: expected size 5, got %d", info.Size())
+	}
+	// Dangling symlinks exist, but their targets don't
+	noErr(t, "Symlink", fsys.WriteFile("dangling.txt", []byte("missing.txt"), fs.ModeSymlink|0777))
+	_, err = fsys.Lstat("dangling.txt")
+	noErr(t, "Lstat a dangling symlink", err)
+	_, err = fsys.Stat("dangling.txt")
+	checkError(t, "Stat a dangling symlink", err, fs.ErrNotExist)
+	noErr(t, "RemoveAll a dangling symlink", fsys.RemoveAll("dangling.txt"))
+	_, err = fsys.Lstat("dangling.txt")
+	checkError(t, "Lstat a removed symlink", err, fs.ErrNotExist)
+	// Symlink loops fail instead of hanging
+	noErr(t, "Symlink", fsys.WriteFile("loop1", []byte("loop2"), fs.ModeSymlink|0777))
+	noErr(t, "Symlink", fsys.WriteFile("loop2", []byte("loop1"), fs.ModeSymlink|0777))
+	_, err = fsys.Stat("loop1")
+	checkError(t, "Stat a symlink loop", err, nil)
+	// Removing a symlink keeps the target
+	noErr(t, "RemoveAll a symlink", fsys.RemoveAll("link.txt"))
+	_, err = fsys.Lstat("target.txt")
+	noErr(t, "Lstat the target", err)
+}
+
+func (c *conformance) testOpenFile(t *testing.T) {
+	fsys := c.newFS(t)
+	write := func(name string, flag int, data string) {
+		t.Helper()
+		f, err := fsys.OpenFile(name, flag, 0644)
+		if err != nil && flag&os.O_CREATE != 0 && errors.Is(err, fs.ErrNotExist) {
+			c.differs(t, NoCreate, "OpenFile %s with O_CREATE: %v", name, err)
+			// Create the file another way, so the other flags are still checked
+			noErr(t, "WriteFile", fsys.WriteFile(name, nil, 0644))
+			f, err = fsys.OpenFile(name, flag&^(os.O_CREATE|os.O_EXCL), 0644)
+		}
+		noErr(t, "OpenFile", err)
+		_, err = f.Write([]byte(data))
+		noErr(t, "Write", err)
+		noErr(t, "Close", f.Close())
+	}
+	expect := func(name, expect string) {
+		t.Helper()
+		if data := readFile(t, fsys, name); data != expect {
+			t.Errorf("ReadFile %s: expected %q, got %q", name, expect, data)
+		}
+	}
+	write("a.txt", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, "hello")
+	expect("a.txt", "hello")
+	info, err := fsys.Stat("a.txt")
+	noErr(t, "Stat", err)
+	if info.Size() != 5 || info.Mode() != 0644 {
+		t.Errorf("Stat: expected size 5 and mode %s, got %d and %s", fs.FileMode(0644), info.Size(), info.Mode())
+	}
+	write("a.txt", os.O_WRONLY|os.O_TRUNC, "hi")
+	expect("a.txt", "hi")
+	write("a.txt", os.O_WRONLY|os.O_APPEND, " there")
+	expect("a.txt", "hi there")
+	write("b.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, "b")
+	expect("b.txt", "b")
+	// Writing without truncating overwrites the start of the file
+	f, err := fsys.OpenFile("a.txt", os.O_RDWR, 0)
+	noErr(t, "OpenFile O_RDWR", err)
+	_, err = f.Write([]byte("HI"))
+	noErr(t, "Write", err)
+	rest, err := io.ReadAll(f)
+	noErr(t, "Read", err)
+	if string(rest) != " there" {
+		t.Errorf("Read after Write: expected %q, got %q", " there", rest)
+	}
+	info, err = f.Stat()
+	noErr(t, "Stat", err)
+	if info.Size() != 8 {
+		t.Errorf("Stat: expected size 8, got %d", info.Size())
+	}
+	noErr(t, "Close", f.Close())
+	expect("a.txt", "HI there")
+}
+
+func (c *conformance) testOpenFileError(t *testing.T) {
+	fsys := c.newFS(t)
+	noErr(t, "WriteFile", fsys.WriteFile("a.txt", []byte("a"), 0644))
+	noErr(t, "MkdirAll", fsys.MkdirAll("dir", 0755))
+	_, err := fsys.OpenFile("a.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	checkError(t, "OpenFile O_EXCL", err, fs.ErrExist)
+	_, err = fsys.OpenFile("dir", os.O_WRONLY, 0)
+	checkError(t, "OpenFile a directory for writing", err, nil)
+	_, err = fsys.OpenFile("a.txt/b.txt", os.O_WRONLY|os.O_CREATE, 0644)
+	checkError(t, "OpenFile within a file", err, nil)
+	// Reading and writing need the right access mode
+	f, err := fsys.OpenFile("a.txt", os.O_RDONLY, 0)
+	noErr(t, "OpenFile O_RDONLY", err)
+	if _, err := f.Write([]byte("b")); err == nil {
+		t.Errorf("Write: expected an error writing to a read-only file")
+	}
+	noErr(t, "Close", f.Close())
+	f, err = fsys.OpenFile("a.txt", os.O_WRONLY, 0)
+	noErr(t, "OpenFile O_WRONLY", err)
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Read: expected an error reading a write-only file")
+	}
+	noErr(t, "Close", f.Close())
+	f, err = fsys.OpenFile("missing/a.txt", os.O_WRONLY|os.O_CREATE, 0644)
+	if err == nil {
+		f.Close()
+		c.differs(t, ImplicitDirs, "OpenFile in a missing directory: expected fs.ErrNotExist, got nil")
+		return
+	}
+	checkError(t, "OpenFile in a missing directory", err, fs.ErrNotExist)
+}
@@ -0,0 +1,16 @@
+//go:build go1.25
+
+package virttest_test
+
+import (
+	"testing"
+
+	"github.com/matthewmueller/virt"
+	"github.com/matthewmueller/virt/virttest"
+)
+
+func TestFSRoot(t *testing.T) {
+	virttest.TestFS(t, func(t *testing.T) virt.FS {
+		return virt.Root(t.TempDir())
+	})
+}
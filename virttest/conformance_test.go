@@ -0,0 +1,68 @@
+package virttest_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matthewmueller/virt"
+	"github.com/matthewmueller/virt/virttest"
+)
+
+func TestFSTree(t *testing.T) {
+	virttest.TestFS(t, func(t *testing.T) virt.FS {
+		return virt.Tree{}
+	}, virttest.ImplicitDirs)
+}
+
+func TestFSList(t *testing.T) {
+	virttest.TestFS(t, func(t *testing.T) virt.FS {
+		return &virt.List{}
+	}, virttest.ImplicitDirs, virttest.NoCreate)
+}
+
+func TestFSOS(t *testing.T) {
+	virttest.TestFS(t, func(t *testing.T) virt.FS {
+		return virt.OS(t.TempDir())
+	})
+}
+
+func TestFSSubOS(t *testing.T) {
+	virttest.TestFS(t, func(t *testing.T) virt.FS {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		fsys, err := virt.Sub(virt.OS(dir), "sub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fsys
+	})
+}
+
+func TestFSSubTree(t *testing.T) {
+	virttest.TestFS(t, func(t *testing.T) virt.FS {
+		fsys, err := virt.Sub(virt.Tree{}, "sub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fsys
+	}, virttest.ImplicitDirs)
+}
+
+func TestFSAtomicOS(t *testing.T) {
+	virttest.TestFS(t, func(t *testing.T) virt.FS {
+		return virt.AtomicOS(t.TempDir())
+	})
+}
+
+func TestFSQuota(t *testing.T) {
+	virttest.TestFS(t, func(t *testing.T) virt.FS {
+		fsys, err := virt.Quota(virt.OS(t.TempDir()), virt.Limits{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fsys
+	})
+}
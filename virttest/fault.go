@@ -0,0 +1,237 @@
+package virttest
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/matthewmueller/virt"
+)
+
+// Rule injects a fault into the calls it matches. A rule with no effects only
+// counts the calls it matches.
+type Rule struct {
+	// Op is the method to match: "OpenFile", "WriteFile", "MkdirAll",
+	// "RemoveAll", or "Write" and "Close" on files opened with OpenFile. Reads
+	// like "Open", "Stat", "Lstat", "Readlink" and "ReadDir" can be matched too.
+	// Empty matches every call that writes: OpenFile with write flags,
+	// WriteFile, MkdirAll, RemoveAll and Write.
+	Op string
+	// Path is a path.Match pattern for the name. Empty matches every path.
+	Path string
+	// Nth only faults the Nth matching call, starting from 1. Zero faults every
+	// matching call.
+	Nth int
+
+	// Err is returned within a *fs.PathError, like fs.ErrPermission or
+	// ErrNoSpace
+	Err error
+	// ShortWrite writes only the first bytes of the data for Write and
+	// WriteFile, then fails with io.ErrShortWrite
+	ShortWrite int
+	// Latency is added before the call
+	Latency time.Duration
+}
+
+// Fault wraps the filesystem to inject faults into the calls that match the
+// rules. Every matching rule counts the call, but only the first one with an
+// effect applies to it. Use it to test how code behaves when a disk misbehaves
+// partway through.
+func Fault(fsys virt.FS, rules ...Rule) *FaultFS {
+	return &FaultFS{fs: fsys, rules: rules, calls: make([]int, len(rules))}
+}
+
+// FaultFS is a filesystem that injects faults. It's safe for concurrent use
+// when the underlying filesystem is.
+type FaultFS struct {
+	fs    virt.FS
+	rules []Rule
+
+	mu    sync.Mutex
+	calls []int // Number of calls each rule has matched
+}
+
+var _ virt.FS = (*FaultFS)(nil)
+
+// Calls returns the number of calls the rule at index has matched
+func (f *FaultFS) Calls(index int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[index]
+}
+
+// fault counts the call against every rule that matches it, then finds the
+// first rule with an effect, adds its latency and returns it. Returns nil if no
+// rule faults the call.
+func (f *FaultFS) fault(op, name string, write bool) *Rule {
+	f.mu.Lock()
+	var rule *Rule
+	for i := range f.rules {
+		r := &f.rules[i]
+		if r.Op == "" && !write || r.Op != "" && r.Op != op {
+			continue
+		}
+		if r.Path != "" {
+			if ok, _ := path.Match(r.Path, name); !ok {
+				continue
+			}
+		}
+		f.calls[i]++
+		if rule != nil || r.Nth > 0 && f.calls[i] != r.Nth {
+			continue
+		}
+		// Rules that only count calls don't stop later rules from applying
+		if r.Err != nil || r.ShortWrite > 0 || r.Latency > 0 {
+			rule = r
+		}
+	}
+	f.mu.Unlock()
+	if rule != nil && rule.Latency > 0 {
+		time.Sleep(rule.Latency)
+	}
+	return rule
+}
+
+// check returns the rule's error for the call
+func (f *FaultFS) check(op, name string, write bool) error {
+	rule := f.fault(op, name, write)
+	if rule == nil || rule.Err == nil {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: name, Err: rule.Err}
+}
+
+func (f *FaultFS) Open(name string) (fs.File, error) {
+	if err := f.check("Open", name, false); err != nil {
+		return nil, err
+	}
+	return f.fs.Open(name)
+}
+
+func (f *FaultFS) Stat(name string) (fs.FileInfo, error) {
+	if err := f.check("Stat", name, false); err != nil {
+		return nil, err
+	}
+	return f.fs.Stat(name)
+}
+
+func (f *FaultFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.check("ReadDir", name, false); err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(f.fs, name)
+}
+
+func (f *FaultFS) Lstat(name string) (fs.FileInfo, error) {
+	if err := f.check("Lstat", name, false); err != nil {
+		return nil, err
+	}
+	return f.fs.Lstat(name)
+}
+
+func (f *FaultFS) Readlink(name string) (string, error) {
+	if err := f.check("Readlink", name, false); err != nil {
+		return "", err
+	}
+	return f.fs.Readlink(name)
+}
+
+func (f *FaultFS) OpenFile(name string, flag int, perm fs.FileMode) (virt.RWFile, error) {
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_EXCL|os.O_TRUNC|os.O_APPEND) != 0
+	if err := f.check("OpenFile", name, write); err != nil {
+		return nil, err
+	}
+	file, err := f.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{file, f, name}, nil
+}
+
+func (f *FaultFS) MkdirAll(path string, perm fs.FileMode) error {
+	if err := f.check("MkdirAll", path, true); err != nil {
+		return err
+	}
+	return f.fs.MkdirAll(path, perm)
+}
+
+func (f *FaultFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	rule := f.fault("WriteFile", name, true)
+	if rule == nil {
+		return f.fs.WriteFile(name, data, perm)
+	}
+	if rule.ShortWrite > 0 && rule.ShortWrite < len(data) {
+		if err := f.fs.WriteFile(name, data[:rule.ShortWrite], perm); err != nil {
+			return err
+		}
+		return &fs.PathError{Op: "WriteFile", Path: name, Err: io.ErrShortWrite}
+	}
+	if rule.Err != nil {
+		return &fs.PathError{Op: "WriteFile", Path: name, Err: rule.Err}
+	}
+	return f.fs.WriteFile(name, data, perm)
+}
+
+func (f *FaultFS) RemoveAll(path string) error {
+	if err := f.check("RemoveAll", path, true); err != nil {
+		return err
+	}
+	return f.fs.RemoveAll(path)
+}
+
+// faultFile injects faults into writing and closing a file
+type faultFile struct {
+	virt.RWFile
+	f    *FaultFS
+	name string
+}
+
+var _ fs.ReadDirFile = (*faultFile)(nil)
+var _ io.Seeker = (*faultFile)(nil)
+
+func (file *faultFile) Write(p []byte) (int, error) {
+	rule := file.f.fault("Write", file.name, true)
+	if rule == nil {
+		return file.RWFile.Write(p)
+	}
+	if rule.ShortWrite > 0 && rule.ShortWrite < len(p) {
+		n, err := file.RWFile.Write(p[:rule.ShortWrite])
+		if err != nil {
+			return n, err
+		}
+		return n, &fs.PathError{Op: "write", Path: file.name, Err: io.ErrShortWrite}
+	}
+	if rule.Err != nil {
+		return 0, &fs.PathError{Op: "write", Path: file.name, Err: rule.Err}
+	}
+	return file.RWFile.Write(p)
+}
+
+// Close closes the underlying file even when it fails, so it doesn't leak
+func (file *faultFile) Close() error {
+	err := file.RWFile.Close()
+	if fault := file.f.check("Close", file.name, false); fault != nil {
+		return fault
+	}
+	return err
+}
+
+func (file *faultFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := file.RWFile.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: file.name, Err: errors.New("not a directory")}
+	}
+	return dir.ReadDir(n)
+}
+
+func (file *faultFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := file.RWFile.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: file.name, Err: errors.ErrUnsupported}
+	}
+	return seeker.Seek(offset, whence)
+}
@@ -0,0 +1,9 @@
+//go:build !plan9
+
+package virttest
+
+import "syscall"
+
+// ErrNoSpace is the error returned when a disk is full. It's the platform's
+// ENOSPC, so it matches the errors returned by the OS through errors.Is.
+var ErrNoSpace error = syscall.ENOSPC
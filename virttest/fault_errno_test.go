@@ -0,0 +1,17 @@
+//go:build !plan9
+
+package virttest_test
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt/virttest"
+)
+
+func TestErrNoSpace(t *testing.T) {
+	is := is.New(t)
+	is.True(errors.Is(virttest.ErrNoSpace, syscall.ENOSPC))
+}
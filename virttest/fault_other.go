@@ -0,0 +1,9 @@
+//go:build plan9
+
+package virttest
+
+import "errors"
+
+// ErrNoSpace is the error returned when a disk is full. Plan 9 has no ENOSPC,
+// so it's a sentinel of its own.
+var ErrNoSpace = errors.New("no space left on device")
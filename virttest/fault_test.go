@@ -0,0 +1,122 @@
+package virttest_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+	"github.com/matthewmueller/virt/virttest"
+)
+
+func TestFaultNth(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	fsys := virttest.Fault(tree, virttest.Rule{Nth: 2, Err: virttest.ErrNoSpace})
+	is.NoErr(fsys.WriteFile("a.txt", []byte("a"), 0644))
+	err := fsys.WriteFile("b.txt", []byte("b"), 0644)
+	is.True(errors.Is(err, virttest.ErrNoSpace))
+	var pathErr *fs.PathError
+	is.True(errors.As(err, &pathErr))
+	is.Equal(pathErr.Path, "b.txt")
+	_, ok := tree["b.txt"]
+	is.True(!ok)
+	is.NoErr(fsys.WriteFile("c.txt", []byte("c"), 0644))
+	// Reads aren't counted as writes
+	_, err = fs.ReadFile(fsys, "a.txt")
+	is.NoErr(err)
+	is.Equal(fsys.Calls(0), 3)
+}
+
+func TestFaultRules(t *testing.T) {
+	is := is.New(t)
+	fsys := virttest.Fault(virt.Tree{},
+		// Counting calls doesn't stop the later rules from applying
+		virttest.Rule{Op: "WriteFile"},
+		virttest.Rule{Path: "b.txt", Err: virttest.ErrNoSpace},
+		virttest.Rule{Path: "*.txt", Err: fs.ErrPermission},
+	)
+	err := fsys.WriteFile("a.txt", []byte("a"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	err = fsys.WriteFile("b.txt", []byte("b"), 0644)
+	is.True(errors.Is(err, virttest.ErrNoSpace))
+	is.NoErr(fsys.WriteFile("c.go", []byte("c"), 0644))
+	// Every matching rule counts the call, even when an earlier rule applies
+	is.Equal(fsys.Calls(0), 3)
+	is.Equal(fsys.Calls(1), 1)
+	is.Equal(fsys.Calls(2), 2)
+}
+
+func TestFaultPath(t *testing.T) {
+	is := is.New(t)
+	fsys := virttest.Fault(virt.Tree{},
+		virttest.Rule{Op: "Stat", Path: "secret/*", Err: fs.ErrPermission},
+		virttest.Rule{Path: "secret/*", Err: fs.ErrPermission},
+	)
+	err := fsys.WriteFile("secret/a.txt", []byte("a"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+	is.NoErr(fsys.MkdirAll("secret", 0755))
+	is.NoErr(fsys.WriteFile("public/a.txt", []byte("a"), 0644))
+	_, err = fsys.Stat("public/a.txt")
+	is.NoErr(err)
+	_, err = fsys.Stat("secret/a.txt")
+	is.True(errors.Is(err, fs.ErrPermission))
+}
+
+func TestFaultShortWrite(t *testing.T) {
+	is := is.New(t)
+	tree := virt.Tree{}
+	fsys := virttest.Fault(tree,
+		virttest.Rule{Op: "WriteFile", ShortWrite: 2},
+		virttest.Rule{Op: "Write", ShortWrite: 1},
+	)
+	err := fsys.WriteFile("a.txt", []byte("hello"), 0644)
+	is.True(errors.Is(err, io.ErrShortWrite))
+	is.Equal(string(tree["a.txt"].Data), "he")
+	file, err := fsys.OpenFile("b.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	is.NoErr(err)
+	n, err := file.Write([]byte("hello"))
+	is.Equal(n, 1)
+	is.True(errors.Is(err, io.ErrShortWrite))
+	is.NoErr(file.Close())
+	is.Equal(string(tree["b.txt"].Data), "h")
+}
+
+func TestFaultClose(t *testing.T) {
+	is := is.New(t)
+	fsys := virttest.Fault(virt.OS(t.TempDir()), virttest.Rule{Op: "Close", Err: virttest.ErrNoSpace})
+	file, err := fsys.OpenFile("a.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	is.NoErr(err)
+	_, err = file.Write([]byte("a"))
+	is.NoErr(err)
+	err = file.Close()
+	is.True(errors.Is(err, virttest.ErrNoSpace))
+}
+
+func TestFaultLatency(t *testing.T) {
+	is := is.New(t)
+	fsys := virttest.Fault(virt.Tree{}, virttest.Rule{Op: "MkdirAll", Latency: 20 * time.Millisecond})
+	start := time.Now()
+	is.NoErr(fsys.MkdirAll("a", 0755))
+	is.True(time.Since(start) >= 20*time.Millisecond)
+}
+
+func TestFaultSync(t *testing.T) {
+	is := is.New(t)
+	from := virt.Map{
+		"a.txt": "a",
+		"b.txt": "b",
+		"c.txt": "c",
+	}
+	tree := virt.Tree{}
+	to := virttest.Fault(tree, virttest.Rule{Op: "WriteFile", Nth: 2, Err: virttest.ErrNoSpace})
+	err := virt.SyncFS(from, to)
+	is.True(errors.Is(err, virttest.ErrNoSpace))
+	// Syncing again finishes the job
+	is.NoErr(virt.SyncFS(from, to))
+	virttest.Equal(t, tree, from)
+}
@@ -0,0 +1,119 @@
+// Package virttest provides assertions for testing virtual filesystems.
+//
+// Golden files are regenerated by setting VIRTTEST_UPDATE=1 in the environment
+// rather than with an -update flag, so importing virttest doesn't register a
+// flag that clashes with the importer's own:
+//
+//	VIRTTEST_UPDATE=1 go test ./...
+package virttest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/matthewmueller/virt"
+)
+
+// update returns true if the golden files should be rewritten. It's read from
+// the environment rather than a flag, so importing virttest doesn't register
+// flags that may conflict with the importer's own.
+func update() bool {
+	ok, _ := strconv.ParseBool(os.Getenv("VIRTTEST_UPDATE"))
+	return ok
+}
+
+// Golden asserts that the filesystem matches the golden directory or txtar file
+// on disk. Paths ending in ".txtar" are read as txtar archives. On mismatch,
+// the test fails with a unified diff of each file that changed.
+//
+// To rewrite the golden copy instead, run the tests with VIRTTEST_UPDATE set to
+// a true value like 1, as in "VIRTTEST_UPDATE=1 go test ./...". There's no
+// -update flag. Golden directories are updated with SyncFS, so unchanged files
+// are left alone and stale files are removed.
+func Golden(t testing.TB, fsys fs.FS, golden string) {
+	t.Helper()
+	if strings.HasSuffix(golden, ".txtar") {
+		goldenTxtar(t, fsys, golden)
+		return
+	}
+	if update() {
+		if err := os.MkdirAll(golden, 0755); err != nil {
+			t.Fatalf("virttest: unable to update %s: %s", golden, err)
+		}
+		if err := virt.SyncFS(fsys, virt.OS(golden)); err != nil {
+			t.Fatalf("virttest: unable to update %s: %s", golden, err)
+		}
+		return
+	}
+	if _, err := os.Stat(golden); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("virttest: golden directory %s doesn't exist, run with VIRTTEST_UPDATE=1 to create it", golden)
+		}
+		t.Fatalf("virttest: unable to read %s: %s", golden, err)
+	}
+	if changes := diff(t, fsys, virt.OS(golden)); changes != "" {
+		t.Errorf("virttest: %s differs, run with VIRTTEST_UPDATE=1 to accept the changes\n%s", golden, changes)
+	}
+}
+
+func goldenTxtar(t testing.TB, fsys fs.FS, golden string) {
+	t.Helper()
+	// Round-trip through txtar, so the actual files have the same trailing
+	// newlines as the golden copy
+	data, err := virt.MarshalTxtar(fsys)
+	if err != nil {
+		t.Fatalf("virttest: unable to marshal %s: %s", golden, err)
+	}
+	if update() {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			t.Fatalf("virttest: unable to update %s: %s", golden, err)
+		}
+		if err := os.WriteFile(golden, data, 0644); err != nil {
+			t.Fatalf("virttest: unable to update %s: %s", golden, err)
+		}
+		return
+	}
+	actual, err := virt.UnmarshalTxtar(data)
+	if err != nil {
+		t.Fatalf("virttest: unable to unmarshal %s: %s", golden, err)
+	}
+	expect, err := os.ReadFile(golden)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("virttest: golden file %s doesn't exist, run with VIRTTEST_UPDATE=1 to create it", golden)
+		}
+		t.Fatalf("virttest: unable to read %s: %s", golden, err)
+	}
+	expectTree, err := virt.UnmarshalTxtar(expect)
+	if err != nil {
+		t.Fatalf("virttest: unable to unmarshal %s: %s", golden, err)
+	}
+	if changes := diff(t, actual, expectTree); changes != "" {
+		t.Errorf("virttest: %s differs, run with VIRTTEST_UPDATE=1 to accept the changes\n%s", golden, changes)
+	}
+}
+
+// Equal asserts that two filesystems have the same files, modes and symlinks.
+// Modification times are ignored. On mismatch, the test fails with a unified
+// diff from expect to actual.
+func Equal(t testing.TB, actual, expect fs.FS) {
+	t.Helper()
+	if changes := diff(t, actual, expect); changes != "" {
+		t.Errorf("virttest: filesystems differ\n%s", changes)
+	}
+}
+
+// diff returns the changes from expect to actual in the unified diff format
+func diff(t testing.TB, actual, expect fs.FS) string {
+	t.Helper()
+	changes, err := virt.Diff(expect, actual)
+	if err != nil {
+		t.Fatalf("virttest: unable to diff: %s", err)
+	}
+	return changes.String()
+}
@@ -0,0 +1,115 @@
+package virttest_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+	"github.com/matthewmueller/virt/virttest"
+)
+
+// recorder records test failures instead of failing the test
+type recorder struct {
+	testing.TB
+	failed bool
+	fatal  bool
+	output string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failed = true
+	r.output += fmt.Sprintf(format, args...)
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func TestEqual(t *testing.T) {
+	is := is.New(t)
+	actual := virt.Tree{
+		"a.txt":   &virt.File{Data: []byte("a\n")},
+		"b/c.txt": &virt.File{Data: []byte("c\n")},
+	}
+	rec := &recorder{TB: t}
+	virttest.Equal(rec, actual, virt.Tree{
+		"a.txt":   &virt.File{Data: []byte("a\n"), Mode: 0644},
+		"b/c.txt": &virt.File{Data: []byte("c\n")},
+	})
+	is.True(!rec.failed)
+	rec = &recorder{TB: t}
+	virttest.Equal(rec, actual, virt.Tree{
+		"a.txt": &virt.File{Data: []byte("b\n")},
+	})
+	is.True(rec.failed)
+	is.True(!rec.fatal)
+	is.True(strings.Contains(rec.output, "-b\n+a\n"))
+	is.True(strings.Contains(rec.output, "+++ b/b/c.txt\n"))
+}
+
+func TestGoldenDir(t *testing.T) {
+	is := is.New(t)
+	golden := filepath.Join(t.TempDir(), "golden")
+	fsys := virt.Tree{
+		"a.txt":   &virt.File{Data: []byte("a\n")},
+		"b/c.txt": &virt.File{Data: []byte("c\n"), Mode: 0600},
+	}
+	// Missing golden directories fail
+	rec := &recorder{TB: t}
+	virttest.Golden(rec, fsys, golden)
+	is.True(rec.fatal)
+	is.True(strings.Contains(rec.output, "VIRTTEST_UPDATE=1"))
+	// Update creates the golden directory
+	t.Setenv("VIRTTEST_UPDATE", "1")
+	virttest.Golden(t, fsys, golden)
+	data, err := os.ReadFile(filepath.Join(golden, "b", "c.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "c\n")
+	t.Setenv("VIRTTEST_UPDATE", "")
+	virttest.Golden(t, fsys, golden)
+	// Changes are reported
+	fsys["a.txt"] = &virt.File{Data: []byte("b\n")}
+	rec = &recorder{TB: t}
+	virttest.Golden(rec, fsys, golden)
+	is.True(rec.failed)
+	is.True(strings.Contains(rec.output, "--- a/a.txt\n+++ b/a.txt\n"))
+	// Update removes stale files
+	delete(fsys, "b/c.txt")
+	t.Setenv("VIRTTEST_UPDATE", "1")
+	virttest.Golden(t, fsys, golden)
+	_, err = os.Stat(filepath.Join(golden, "b", "c.txt"))
+	is.True(os.IsNotExist(err))
+	t.Setenv("VIRTTEST_UPDATE", "")
+	virttest.Golden(t, fsys, golden)
+}
+
+func TestGoldenTxtar(t *testing.T) {
+	is := is.New(t)
+	golden := filepath.Join(t.TempDir(), "testdata", "golden.txtar")
+	fsys := virt.Tree{
+		"a.txt":   &virt.File{Data: []byte("no newline")},
+		"bin/run": &virt.File{Data: []byte("#!/bin/sh\n"), Mode: 0755},
+	}
+	rec := &recorder{TB: t}
+	virttest.Golden(rec, fsys, golden)
+	is.True(rec.fatal)
+	t.Setenv("VIRTTEST_UPDATE", "1")
+	virttest.Golden(t, fsys, golden)
+	data, err := os.ReadFile(golden)
+	is.NoErr(err)
+	is.True(strings.Contains(string(data), "-- a.txt --\nno newline\n"))
+	t.Setenv("VIRTTEST_UPDATE", "")
+	virttest.Golden(t, fsys, golden)
+	fsys["bin/run"].Mode = 0644
+	rec = &recorder{TB: t}
+	virttest.Golden(rec, fsys, golden)
+	is.True(rec.failed)
+	is.True(strings.Contains(rec.output, "old mode -rwxr-xr-x\nnew mode -rw-r--r--\n"))
+}
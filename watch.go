@@ -0,0 +1,432 @@
+package virt
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Op is the type of change to a path
+type Op uint8
+
+const (
+	OpCreate Op = iota + 1
+	OpWrite
+	OpRemove
+	OpChmod
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpCreate:
+		return "create"
+	case OpWrite:
+		return "write"
+	case OpRemove:
+		return "remove"
+	case OpChmod:
+		return "chmod"
+	default:
+		return ""
+	}
+}
+
+// Event is a change to a path in a watched filesystem
+type Event struct {
+	Op   Op
+	Path string
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Path
+}
+
+// WatchOption configures Watch
+type WatchOption func(*watcher)
+
+// PollInterval sets how often the filesystem is polled for changes. Defaults to
+// 500ms.
+func PollInterval(interval time.Duration) WatchOption {
+	return func(w *watcher) {
+		w.interval = interval
+	}
+}
+
+// WatchErrors calls fn with errors that occur while comparing snapshots. By
+// default, comparisons that fail are skipped and retried on the next change.
+func WatchErrors(fn func(error)) WatchOption {
+	return func(w *watcher) {
+		w.onError = fn
+	}
+}
+
+// Watch the filesystem for changes until the context is canceled. Changes are
+// found by periodically comparing snapshots of each path's size, mode and
+// modification time, similar to Sync. Directories only report create, remove
+// and chmod events, since their modification times change with their
+// contents.
+//
+// Filesystems that report their own changes, like Tree, aren't polled, since
+// they may not be safe for concurrent use. Instead, they describe each change
+// as it's written, so only changes made through the filesystem's methods are
+// reported.
+//
+// The channel is closed after the context is canceled.
+func Watch(ctx context.Context, fsys fs.FS, options ...WatchOption) (<-chan Event, error) {
+	w := &watcher{
+		fsys:     fsys,
+		interval: 500 * time.Millisecond,
+		onError:  func(error) {},
+		events:   make(chan Event),
+		changes:  map[string]fs.FileInfo{},
+		touched:  make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(w)
+	}
+	snapshot, err := w.snapshot(".")
+	if err != nil {
+		return nil, err
+	}
+	w.current = snapshot
+	if notifier, ok := fsys.(changeNotifier); ok {
+		stop := notifier.OnChange(w.touch)
+		go func() {
+			defer close(w.events)
+			defer stop()
+			w.notify(ctx)
+		}()
+		return w.events, nil
+	}
+	go func() {
+		defer close(w.events)
+		w.poll(ctx)
+	}()
+	return w.events, nil
+}
+
+// changeNotifier is implemented by filesystems that report their own changes
+type changeNotifier interface {
+	OnChange(fn func(path string, info fs.FileInfo)) (stop func())
+}
+
+type watcher struct {
+	fsys     fs.FS
+	interval time.Duration
+	onError  func(error)
+	events   chan Event
+	current  map[string]stamped
+
+	// Changes reported by the filesystem that haven't been applied yet. Changes
+	// to the same path are coalesced, so only the latest is kept.
+	mu      sync.Mutex
+	changes map[string]fs.FileInfo
+	order   []string
+	touched chan struct{}
+}
+
+// stamped is the state of a path in a snapshot
+type stamped struct {
+	mode  fs.FileMode
+	stamp string
+}
+
+func stampedInfo(info fs.FileInfo) stamped {
+	// The mode is left out of the stamp, so chmods aren't reported as writes
+	return stamped{
+		mode:  info.Mode(),
+		stamp: stampInfo(info.Size(), 0, info.ModTime()),
+	}
+}
+
+// touch is called by the filesystem after a path changes, with the path's new
+// info or nil if it was removed. It only queues the change, so it's cheap to
+// call while writing.
+func (w *watcher) touch(fpath string, info fs.FileInfo) {
+	w.mu.Lock()
+	if info == nil {
+		// Removing a path replaces any pending changes within it
+		order := w.order[:0]
+		for _, pending := range w.order {
+			if within(fpath, pending) {
+				delete(w.changes, pending)
+				continue
+			}
+			order = append(order, pending)
+		}
+		w.order = order
+	}
+	if _, ok := w.changes[fpath]; !ok {
+		w.order = append(w.order, fpath)
+	}
+	w.changes[fpath] = info
+	w.mu.Unlock()
+	select {
+	case w.touched <- struct{}{}:
+	default:
+	}
+}
+
+// notify applies the changes reported by the filesystem and sends the events
+func (w *watcher) notify(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.touched:
+			w.mu.Lock()
+			changes, order := w.changes, w.order
+			w.changes, w.order = map[string]fs.FileInfo{}, nil
+			w.mu.Unlock()
+			var events []Event
+			for _, fpath := range order {
+				events = append(events, w.apply(fpath, changes[fpath])...)
+			}
+			if !w.send(ctx, events) {
+				return
+			}
+		}
+	}
+}
+
+// apply a change reported by the filesystem to the snapshot, without reading
+// from the filesystem
+func (w *watcher) apply(fpath string, info fs.FileInfo) (events []Event) {
+	if info == nil {
+		for name := range w.current {
+			if within(fpath, name) {
+				events = append(events, Event{OpRemove, name})
+				delete(w.current, name)
+			}
+		}
+		sortEvents(events)
+		return events
+	}
+	// Parent directories are created along with the path. They're synthesized
+	// like Tree synthesizes them, since parents that were created explicitly
+	// are reported on their own.
+	for dir := path.Dir(fpath); dir != "."; dir = path.Dir(dir) {
+		if _, ok := w.current[dir]; ok {
+			break
+		}
+		w.current[dir] = stamped{mode: fs.ModeDir}
+		events = append(events, Event{OpCreate, dir})
+	}
+	events = append(events, w.compare(fpath, stampedInfo(info))...)
+	sortEvents(events)
+	return events
+}
+
+// poll the filesystem for changes
+func (w *watcher) poll(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			events := w.diff(".")
+			w.mu.Unlock()
+			if !w.send(ctx, events) {
+				return
+			}
+		}
+	}
+}
+
+// send the events. Returns false if the context was canceled.
+func (w *watcher) send(ctx context.Context, events []Event) bool {
+	for _, event := range events {
+		select {
+		case <-ctx.Done():
+			return false
+		case w.events <- event:
+		}
+	}
+	return true
+}
+
+// diff the path and everything within it with the last snapshot, returning the
+// changes in path order.
+func (w *watcher) diff(dir string) (events []Event) {
+	next, err := w.snapshot(dir)
+	if err != nil {
+		w.onError(err)
+		return nil
+	}
+	for fpath := range w.current {
+		if !within(dir, fpath) {
+			continue
+		}
+		if _, ok := next[fpath]; !ok {
+			events = append(events, Event{OpRemove, fpath})
+			delete(w.current, fpath)
+		}
+	}
+	for fpath, curr := range next {
+		events = append(events, w.compare(fpath, curr)...)
+	}
+	sortEvents(events)
+	return events
+}
+
+// compare the path's new state with the snapshot, updating the snapshot
+func (w *watcher) compare(fpath string, curr stamped) (events []Event) {
+	prev, ok := w.current[fpath]
+	w.current[fpath] = curr
+	switch {
+	case !ok:
+		events = append(events, Event{OpCreate, fpath})
+	case prev.mode.Type() != curr.mode.Type():
+		events = append(events, Event{OpRemove, fpath}, Event{OpCreate, fpath})
+	default:
+		if prev.mode != curr.mode {
+			events = append(events, Event{OpChmod, fpath})
+		}
+		if !curr.mode.IsDir() && prev.stamp != curr.stamp {
+			events = append(events, Event{OpWrite, fpath})
+		}
+	}
+	return events
+}
+
+// sortEvents sorts the events by path, keeping the order of events for the
+// same path
+func sortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+}
+
+// snapshot the path and everything within it. Missing paths have an empty
+// snapshot.
+func (w *watcher) snapshot(dir string) (map[string]stamped, error) {
+	snapshot := map[string]stamped{}
+	err := fs.WalkDir(w.fsys, dir, func(fpath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			// Paths may be removed while walking
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if fpath == "." {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		snapshot[fpath] = stampedInfo(info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// within returns true if fpath is dir or inside of it
+func within(dir, fpath string) bool {
+	return dir == "." || fpath == dir || strings.HasPrefix(fpath, dir+"/")
+}
+
+// treeWatchers are the functions to call when a Tree changes, keyed by the
+// map's pointer, since a Tree can't store them itself.
+var treeWatchers = struct {
+	sync.Mutex
+	fns map[uintptr]map[*func(string, fs.FileInfo)]bool
+}{fns: map[uintptr]map[*func(string, fs.FileInfo)]bool{}}
+
+// treeWatching counts the functions in treeWatchers, so trees that aren't
+// watched don't need to lock when they're written to
+var treeWatching atomic.Int64
+
+// OnChange calls fn whenever the tree is changed through its methods, with the
+// path and its info, or nil info if the path was removed. Files opened for
+// writing call fn when they're closed. Changing the map directly doesn't call
+// fn. Call stop to stop calling fn.
+func (t Tree) OnChange(fn func(path string, info fs.FileInfo)) (stop func()) {
+	key := reflect.ValueOf(t).Pointer()
+	ref := &fn
+	treeWatchers.Lock()
+	defer treeWatchers.Unlock()
+	if treeWatchers.fns[key] == nil {
+		treeWatchers.fns[key] = map[*func(string, fs.FileInfo)]bool{}
+	}
+	treeWatchers.fns[key][ref] = true
+	treeWatching.Add(1)
+	return func() {
+		treeWatchers.Lock()
+		defer treeWatchers.Unlock()
+		if !treeWatchers.fns[key][ref] {
+			return
+		}
+		delete(treeWatchers.fns[key], ref)
+		if len(treeWatchers.fns[key]) == 0 {
+			delete(treeWatchers.fns, key)
+		}
+		treeWatching.Add(-1)
+	}
+}
+
+// changed notifies the tree's watchers that the path changed
+func (t Tree) changed(fpath string) {
+	if treeWatching.Load() == 0 {
+		return
+	}
+	treeWatchers.Lock()
+	fns := treeWatchers.fns[reflect.ValueOf(t).Pointer()]
+	calls := make([]func(string, fs.FileInfo), 0, len(fns))
+	for fn := range fns {
+		calls = append(calls, *fn)
+	}
+	treeWatchers.Unlock()
+	if len(calls) == 0 {
+		return
+	}
+	fpath = path.Clean(fpath)
+	// Copy the info now, since the file may change after it's reported
+	var info fs.FileInfo
+	if file, ok := t[fpath]; ok {
+		info, _ = file.Info()
+	}
+	for _, fn := range calls {
+		fn(fpath, info)
+	}
+}
+
+// treeFile reports changes to the tree after it's written to and closed
+type treeFile struct {
+	*openFile
+	tree    Tree
+	path    string
+	written bool
+}
+
+func (f *treeFile) Write(p []byte) (int, error) {
+	n, err := f.openFile.Write(p)
+	if n > 0 {
+		f.written = true
+	}
+	return n, err
+}
+
+func (f *treeFile) Close() error {
+	if f.written {
+		f.tree.changed(f.path)
+	}
+	return f.openFile.Close()
+}
@@ -0,0 +1,104 @@
+package virt_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func nextEvent(t testing.TB, events <-chan virt.Event) string {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return event.String()
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return ""
+	}
+}
+
+func TestWatchTree(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := virt.Now
+	defer func() { virt.Now = now }()
+	virt.Now = func() time.Time { return time.Date(2021, 8, 4, 14, 56, 0, 0, time.UTC) }
+	fsys := virt.Tree{
+		"go.mod": &virt.File{Data: []byte("module app")},
+	}
+	// Poll rarely, so the events come from the tree itself
+	events, err := virt.Watch(ctx, fsys, virt.PollInterval(time.Hour))
+	is.NoErr(err)
+	is.NoErr(fsys.WriteFile("a/b.txt", []byte("b"), 0644))
+	is.Equal(nextEvent(t, events), "create a")
+	is.Equal(nextEvent(t, events), "create a/b.txt")
+	is.NoErr(fsys.WriteFile("a/b.txt", []byte("bb"), 0644))
+	is.Equal(nextEvent(t, events), "write a/b.txt")
+	is.NoErr(fsys.WriteFile("a/b.txt", []byte("bb"), 0600))
+	is.Equal(nextEvent(t, events), "chmod a/b.txt")
+	is.NoErr(fsys.RemoveAll("a"))
+	is.Equal(nextEvent(t, events), "remove a")
+	is.Equal(nextEvent(t, events), "remove a/b.txt")
+}
+
+func TestWatchTreeOpenFile(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fsys := virt.Tree{}
+	events, err := virt.Watch(ctx, fsys, virt.PollInterval(time.Hour))
+	is.NoErr(err)
+	file, err := fsys.OpenFile("a.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	is.NoErr(err)
+	is.Equal(nextEvent(t, events), "create a.txt")
+	_, err = file.Write([]byte("hello"))
+	is.NoErr(err)
+	is.NoErr(file.Close())
+	is.Equal(nextEvent(t, events), "write a.txt")
+	// Reading doesn't report a change
+	file, err = fsys.OpenFile("a.txt", os.O_RDWR, 0)
+	is.NoErr(err)
+	is.NoErr(file.Close())
+	is.NoErr(fsys.RemoveAll("a.txt"))
+	is.Equal(nextEvent(t, events), "remove a.txt")
+}
+
+func TestWatchOS(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	events, err := virt.Watch(ctx, virt.OS(dir), virt.PollInterval(10*time.Millisecond))
+	is.NoErr(err)
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	is.Equal(nextEvent(t, events), "create a.txt")
+	is.NoErr(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("aa"), 0644))
+	is.Equal(nextEvent(t, events), "write a.txt")
+	is.NoErr(os.Chmod(filepath.Join(dir, "a.txt"), 0600))
+	is.Equal(nextEvent(t, events), "chmod a.txt")
+	is.NoErr(os.Remove(filepath.Join(dir, "a.txt")))
+	is.Equal(nextEvent(t, events), "remove a.txt")
+}
+
+func TestWatchCancel(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := virt.Watch(ctx, virt.Tree{}, virt.PollInterval(time.Hour))
+	is.NoErr(err)
+	cancel()
+	select {
+	case _, ok := <-events:
+		is.True(!ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for close")
+	}
+}
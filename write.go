@@ -14,6 +14,10 @@ func Write(fsys fs.FS, toDir string, subpaths ...string) error {
 
 // WriteFS writes files from one filesystem to another at subpath. Unlike sync,
 // it does not attempt to remove files that are not in the source filesystem.
+//
+// Symlinks are copied as links rather than as their targets' data. Existing
+// links at the same path are removed first, so writing doesn't go through them
+// to their targets.
 func WriteFS(from fs.FS, to FS, subpaths ...string) error {
 	target := path.Join(subpaths...)
 	if target == "" {
@@ -39,10 +43,16 @@ func WriteFS(from fs.FS, to FS, subpaths ...string) error {
 			}
 			return to.MkdirAll(fpath, mode)
 		}
-		data, err := fs.ReadFile(from, fpath)
+		data, err := readData(from, fpath, mode)
 		if err != nil {
 			return err
 		}
+		// Symlinks can't be overwritten, so remove them first
+		if mode&fs.ModeSymlink != 0 {
+			if err := to.RemoveAll(fpath); err != nil {
+				return err
+			}
+		}
 		// Many of the virtual filesystems don't set a mode. Writing these to an
 		// actual filesystem will cause permission errors, so we'll use common
 		// permissions when not explicitly set.
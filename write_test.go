@@ -124,3 +124,28 @@ func TestWriteExecutable(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(info.Mode(), fs.FileMode(0755))
 }
+
+func TestWriteSymlink(t *testing.T) {
+	is := is.New(t)
+	from := virt.Tree{
+		"a.txt":        &virt.File{Data: []byte("a")},
+		"link.txt":     &virt.File{Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777},
+		"dangling.txt": &virt.File{Data: []byte("missing.txt"), Mode: fs.ModeSymlink | 0777},
+	}
+	toDir := t.TempDir()
+	// Existing symlinks are replaced rather than written through
+	is.NoErr(os.WriteFile(filepath.Join(toDir, "other.txt"), []byte("other"), 0644))
+	is.NoErr(os.Symlink("other.txt", filepath.Join(toDir, "link.txt")))
+	is.NoErr(virt.Write(from, toDir))
+	// Symlinks are copied as links, not as their targets' data
+	link, err := os.Readlink(filepath.Join(toDir, "link.txt"))
+	is.NoErr(err)
+	is.Equal(link, "a.txt")
+	data, err := os.ReadFile(filepath.Join(toDir, "other.txt"))
+	is.NoErr(err)
+	is.Equal(string(data), "other")
+	// Dangling symlinks are copied too
+	link, err = os.Readlink(filepath.Join(toDir, "dangling.txt"))
+	is.NoErr(err)
+	is.Equal(link, "missing.txt")
+}
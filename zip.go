@@ -0,0 +1,328 @@
+package virt
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// WriteZip writes the filesystem at subpath to w as a zip archive. Modes,
+// modification times, symlinks and empty directories are kept.
+func WriteZip(w io.Writer, fsys fs.FS, subpaths ...string) error {
+	dir := path.Join(subpaths...)
+	if dir == "" {
+		dir = "."
+	}
+	list, err := fromFS(fsys, dir)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(w)
+	for _, file := range list {
+		if err := writeZipFile(zw, file); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, file *File) error {
+	header := &zip.FileHeader{
+		Name:     file.Path,
+		Modified: archiveTime(file.ModTime),
+		Method:   zip.Deflate,
+	}
+	mode := file.Mode
+	switch {
+	case file.IsDir():
+		header.Name += "/"
+		header.Method = zip.Store
+		if mode.Perm() == 0 {
+			mode |= 0755
+		}
+	case mode&fs.ModeSymlink != 0:
+		if mode.Perm() == 0 {
+			mode |= 0777
+		}
+	default:
+		if mode.Perm() == 0 {
+			mode |= 0644
+		}
+	}
+	header.SetMode(mode)
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if file.IsDir() {
+		return nil
+	}
+	// Symlink targets are stored as the file contents
+	_, err = w.Write(file.Data)
+	return err
+}
+
+// ReadZip opens a zip archive of the given size. See Zip for details.
+func ReadZip(r io.ReaderAt, size int64) (FS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return Zip(zr)
+}
+
+// Zip returns a read-only filesystem backed by a zip archive. Files are
+// decompressed when they're opened. Modes and modification times come from
+// the zip headers. Entries with absolute paths or ".." elements are rejected.
+// Writes fail with fs.ErrPermission.
+func Zip(zr *zip.Reader) (FS, error) {
+	z := &zipFS{
+		files: map[string]*zip.File{},
+		dirs: map[string]*File{
+			".": {Path: ".", Mode: fs.ModeDir},
+		},
+	}
+	for _, zf := range zr.File {
+		fpath, err := archivePath("Zip", zf.Name)
+		if err != nil {
+			return nil, err
+		} else if fpath == "." {
+			continue
+		}
+		if strings.HasSuffix(zf.Name, "/") || zf.Mode().IsDir() {
+			dir := z.mkdir(fpath)
+			dir.Mode = zf.Mode() | fs.ModeDir
+			dir.ModTime = zf.Modified
+			continue
+		}
+		z.files[fpath] = zf
+		parent := z.mkdir(path.Dir(fpath))
+		parent.Entries = append(parent.Entries, &DirEntry{
+			Path:    fpath,
+			Size:    int64(zf.UncompressedSize64),
+			Mode:    zf.Mode(),
+			ModTime: zf.Modified,
+		})
+	}
+	// Fill in the directory entries, now that all their modes are known
+	for dpath, dir := range z.dirs {
+		if dpath == "." {
+			continue
+		}
+		parent := z.dirs[path.Dir(dpath)]
+		parent.Entries = append(parent.Entries, dir.Entry())
+	}
+	for _, dir := range z.dirs {
+		sort.Slice(dir.Entries, func(i, j int) bool {
+			return dir.Entries[i].Name() < dir.Entries[j].Name()
+		})
+	}
+	return z, nil
+}
+
+type zipFS struct {
+	files map[string]*zip.File
+	dirs  map[string]*File
+}
+
+var _ FS = (*zipFS)(nil)
+var _ fs.ReadDirFS = (*zipFS)(nil)
+var _ fs.ReadFileFS = (*zipFS)(nil)
+
+// mkdir synthesizes the directory and its parents if they don't exist yet
+func (z *zipFS) mkdir(dpath string) *File {
+	if dir, ok := z.dirs[dpath]; ok {
+		return dir
+	}
+	z.mkdir(path.Dir(dpath))
+	dir := &File{Path: dpath, Mode: fs.ModeDir}
+	z.dirs[dpath] = dir
+	return dir
+}
+
+func (z *zipFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := z.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if dir, ok := z.dirs[target]; ok {
+		return &openFile{dir, os.O_RDONLY, 0}, nil
+	}
+	zf := z.files[target]
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	// Like os.Open, opened symlinks keep their own name
+	return &zipFile{rc, zipInfo(name, zf)}, nil
+}
+
+func (z *zipFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := z.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := z.Lstat(target)
+	if err != nil {
+		return nil, err
+	}
+	// Stat returns the original name, but size, mode, and modTime of the target
+	return &fileInfo{
+		path:    name,
+		size:    info.Size(),
+		mode:    info.Mode(),
+		modTime: info.ModTime(),
+	}, nil
+}
+
+func (z *zipFS) Lstat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrInvalid}
+	}
+	if dir, ok := z.dirs[name]; ok {
+		return dir.Info()
+	}
+	zf, ok := z.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+	}
+	return zipInfo(name, zf), nil
+}
+
+func (z *zipFS) Readlink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	zf, ok := z.files[name]
+	if !ok {
+		if _, ok := z.dirs[name]; ok {
+			return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+		}
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	if zf.Mode()&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	link, err := z.readFile(name, zf)
+	if err != nil {
+		return "", err
+	}
+	return string(link), nil
+}
+
+func (z *zipFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	name, err := z.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := z.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotADirectory}
+	}
+	des := make([]fs.DirEntry, len(dir.Entries))
+	for i, de := range dir.Entries {
+		des[i] = de
+	}
+	return des, nil
+}
+
+func (z *zipFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	name, err := z.resolve("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	zf, ok := z.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDirectory}
+	}
+	return z.readFile(name, zf)
+}
+
+func (z *zipFS) OpenFile(name string, flag int, perm fs.FileMode) (RWFile, error) {
+	return nil, &fs.PathError{Op: "OpenFile", Path: name, Err: fs.ErrPermission}
+}
+
+func (z *zipFS) MkdirAll(name string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "MkdirAll", Path: name, Err: fs.ErrPermission}
+}
+
+func (z *zipFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return &fs.PathError{Op: "WriteFile", Path: name, Err: fs.ErrPermission}
+}
+
+func (z *zipFS) RemoveAll(name string) error {
+	return &fs.PathError{Op: "RemoveAll", Path: name, Err: fs.ErrPermission}
+}
+
+// resolve follows symlinks in the last element of name. Like symlinks on disk,
+// link targets are relative to the directory containing the link.
+func (z *zipFS) resolve(op, name string) (string, error) {
+	for links := 0; links <= maxSymlinks; links++ {
+		if _, ok := z.dirs[name]; ok {
+			return name, nil
+		}
+		zf, ok := z.files[name]
+		if !ok {
+			return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if zf.Mode()&fs.ModeSymlink == 0 {
+			return name, nil
+		}
+		link, err := z.readFile(name, zf)
+		if err != nil {
+			return "", err
+		}
+		target := path.Join(path.Dir(name), string(link))
+		if strings.HasPrefix(string(link), "/") || !fs.ValidPath(target) {
+			return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		name = target
+	}
+	return "", &fs.PathError{Op: op, Path: name, Err: errTooManySymlinks}
+}
+
+func (z *zipFS) readFile(name string, zf *zip.File) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func zipInfo(name string, zf *zip.File) *fileInfo {
+	return &fileInfo{
+		path:    name,
+		size:    int64(zf.UncompressedSize64),
+		mode:    zf.Mode(),
+		modTime: zf.Modified,
+	}
+}
+
+// zipFile is a file being decompressed from a zip archive
+type zipFile struct {
+	io.ReadCloser
+	info *fileInfo
+}
+
+var _ fs.File = (*zipFile)(nil)
+
+func (f *zipFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
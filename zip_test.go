@@ -0,0 +1,97 @@
+package virt_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/matthewmueller/virt"
+)
+
+func TestZipRoundTrip(t *testing.T) {
+	is := is.New(t)
+	modTime := time.Date(2021, 8, 4, 14, 56, 0, 0, time.UTC)
+	tree := virt.Tree{
+		"a.txt":      &virt.File{Data: []byte("a"), Mode: 0644, ModTime: modTime},
+		"bin/run.sh": &virt.File{Data: []byte("#!/bin/sh"), Mode: 0755, ModTime: modTime},
+		"empty":      &virt.File{Mode: 0700 | fs.ModeDir, ModTime: modTime},
+		"link.txt":   &virt.File{Data: []byte("a.txt"), Mode: 0777 | fs.ModeSymlink, ModTime: modTime},
+	}
+	buf := new(bytes.Buffer)
+	is.NoErr(virt.WriteZip(buf, tree))
+	fsys, err := virt.ReadZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	is.NoErr(err)
+	is.NoErr(fstest.TestFS(fsys, "a.txt", "bin/run.sh", "empty", "link.txt"))
+
+	data, err := fs.ReadFile(fsys, "bin/run.sh")
+	is.NoErr(err)
+	is.Equal(string(data), "#!/bin/sh")
+	info, err := fsys.Stat("bin/run.sh")
+	is.NoErr(err)
+	is.Equal(info.Mode(), fs.FileMode(0755))
+	is.True(info.ModTime().Equal(modTime))
+	info, err = fsys.Stat("empty")
+	is.NoErr(err)
+	is.Equal(info.Mode(), fs.FileMode(0700|fs.ModeDir))
+
+	// Symlinks
+	info, err = fsys.Lstat("link.txt")
+	is.NoErr(err)
+	is.Equal(info.Mode(), fs.FileMode(0777|fs.ModeSymlink))
+	link, err := fsys.Readlink("link.txt")
+	is.NoErr(err)
+	is.Equal(link, "a.txt")
+	data, err = fs.ReadFile(fsys, "link.txt")
+	is.NoErr(err)
+	is.Equal(string(data), "a")
+	file, err := virt.From(fsys, "link.txt")
+	is.NoErr(err)
+	is.Equal(string(file.Data), "a.txt")
+
+	// Read-only
+	err = fsys.WriteFile("b.txt", []byte("b"), 0644)
+	is.True(errors.Is(err, fs.ErrPermission))
+}
+
+func TestZipMerge(t *testing.T) {
+	is := is.New(t)
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("plugin/plugin.js")
+	is.NoErr(err)
+	_, err = w.Write([]byte("plugin"))
+	is.NoErr(err)
+	is.NoErr(zw.Close())
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	is.NoErr(err)
+	plugin, err := virt.Zip(zr)
+	is.NoErr(err)
+	project := virt.Map{"main.js": "main"}
+	fsys := virt.Merge(project, plugin)
+	des, err := fs.ReadDir(fsys, ".")
+	is.NoErr(err)
+	is.Equal(len(des), 2)
+	is.Equal(des[0].Name(), "main.js")
+	is.Equal(des[1].Name(), "plugin")
+	data, err := fs.ReadFile(fsys, "plugin/plugin.js")
+	is.NoErr(err)
+	is.Equal(string(data), "plugin")
+}
+
+func TestZipUnsafe(t *testing.T) {
+	is := is.New(t)
+	for _, name := range []string{"../a.txt", "/etc/passwd", "a/../../b.txt"} {
+		buf := new(bytes.Buffer)
+		zw := zip.NewWriter(buf)
+		_, err := zw.Create(name)
+		is.NoErr(err)
+		is.NoErr(zw.Close())
+		_, err = virt.ReadZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		is.True(errors.Is(err, fs.ErrInvalid))
+	}
+}